@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"html/template"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// GitHub style admonitions, a blockquote starting with [!KIND]. Text after the
+// marker on the same line replaces the default title.
+var admonitionTitles = map[string]string{
+	"note": "Note",
+	"tip": "Tip",
+	"important": "Important",
+	"warning": "Warning",
+	"caution": "Caution",
+}
+
+var admonitionMarker = regexp.MustCompile(`^\[!([A-Za-z]+)\]([^\n]*)\n?`)
+
+type admonitionNode struct {
+	ast.Container
+	Kind string
+	Title string
+}
+
+// Replaces blockquotes starting with an admonition marker. The parser joins
+// blockquotes separated by blank lines, so every marker paragraph inside a
+// blockquote starts a new admonition.
+func ReplaceAdmonitions(doc ast.Node) {
+	quotes := make([]*ast.BlockQuote, 0, 4)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if quote, ok := node.(*ast.BlockQuote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.GoToNext
+	})
+
+	for _, quote := range quotes {
+		hasMarker := slices.ContainsFunc(quote.Children, func(child ast.Node) bool {
+			return admonitionFromParagraph(child, false) != nil
+		})
+		if !hasMarker {
+			continue
+		}
+
+		nodes := make([]ast.Node, 0, 2)
+		var current ast.Node
+
+		for _, child := range quote.Children {
+			if node := admonitionFromParagraph(child, true); node != nil {
+				current = node
+				nodes = append(nodes, current)
+				if len(child.GetChildren()) == 0 {
+					continue
+				}
+			} else if current == nil {
+				current = &ast.BlockQuote{}
+				nodes = append(nodes, current)
+			}
+			child.SetParent(current)
+			current.SetChildren(append(current.GetChildren(), child))
+		}
+
+		parent := quote.Parent.AsContainer()
+		for i, child := range parent.Children {
+			if child != ast.Node(quote) {
+				continue
+			}
+			parent.Children = append(parent.Children[:i], append(nodes, parent.Children[i + 1:]...)...)
+			break
+		}
+		for _, node := range nodes {
+			node.SetParent(quote.Parent)
+		}
+	}
+}
+
+// Returns the admonition a paragraph starts, if any, strip removes the marker
+// from the paragraph
+func admonitionFromParagraph(node ast.Node, strip bool) *admonitionNode {
+	paragraph, ok := node.(*ast.Paragraph)
+	if !ok || len(paragraph.Children) == 0 {
+		return nil
+	}
+	text, ok := paragraph.Children[0].(*ast.Text)
+	if !ok {
+		return nil
+	}
+
+	match := admonitionMarker.FindSubmatch(text.Literal)
+	if match == nil {
+		return nil
+	}
+	kind := strings.ToLower(string(match[1]))
+	title, ok := admonitionTitles[kind]
+	if !ok {
+		return nil
+	}
+	if custom := strings.TrimSpace(string(match[2])); custom != "" {
+		title = custom
+	}
+
+	if strip {
+		text.Literal = text.Literal[len(match[0]):]
+		if len(text.Literal) == 0 {
+			paragraph.Children = paragraph.Children[1:]
+		}
+	}
+
+	return &admonitionNode{Kind: kind, Title: title}
+}
+
+func renderAdmonition(w io.Writer, node *admonitionNode, entering bool) (ast.WalkStatus, bool) {
+	if entering {
+		io.WriteString(w, `<aside class="admonition admonition-` + node.Kind + `" role="note">` + "\n")
+		io.WriteString(w, `<p class="admonition-title">` + template.HTMLEscapeString(node.Title) + "</p>\n")
+	} else {
+		io.WriteString(w, "</aside>\n")
+	}
+	return ast.GoToNext, true
+}
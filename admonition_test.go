@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAdmonitions(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		want string
+	}{
+		{
+			name: "note",
+			source: "> [!NOTE]\n> Body *x*\n",
+			want: `<aside class="admonition admonition-note" role="note">` + "\n" +
+				`<p class="admonition-title">Note</p>` + "\n<p>Body <em>x</em></p>\n</aside>\n",
+		},
+		{
+			name: "custom title",
+			source: "> [!WARNING] Fish & chips\n> one\n",
+			want: `<aside class="admonition admonition-warning" role="note">` + "\n" +
+				`<p class="admonition-title">Fish &amp; chips</p>` + "\n<p>one</p>\n</aside>\n",
+		},
+		{
+			name: "joined blockquotes",
+			source: "> [!TIP]\n> one\n\n> [!caution]\n> two\n",
+			want: `<aside class="admonition admonition-tip" role="note">` + "\n" +
+				`<p class="admonition-title">Tip</p>` + "\n<p>one</p>\n</aside>\n" +
+				`<aside class="admonition admonition-caution" role="note">` + "\n" +
+				`<p class="admonition-title">Caution</p>` + "\n<p>two</p>\n</aside>\n",
+		},
+		{
+			name: "quote before marker",
+			source: "> plain\n>\n> [!IMPORTANT]\n> after\n",
+			want: "<blockquote>\n<p>plain</p>\n</blockquote>\n" +
+				`<aside class="admonition admonition-important" role="note">` + "\n" +
+				`<p class="admonition-title">Important</p>` + "\n<p>after</p>\n</aside>\n",
+		},
+		{
+			name: "unknown kind",
+			source: "> [!FOO]\n> x\n",
+			want: "<blockquote>\n<p>[!FOO]\nx</p>\n</blockquote>\n",
+		},
+		{
+			name: "marker later in paragraph",
+			source: "> x [!NOTE]\n",
+			want: "<blockquote>\n<p>x [!NOTE]</p>\n</blockquote>\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("admonition", "---\ntitle: T\n---\n" + test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(article.Content) != test.want {
+				t.Errorf("content\n%s\nwant\n%s", article.Content, test.want)
+			}
+		})
+	}
+
+	md := DefaultMarkdownOptions
+	md.Admonitions = false
+	article, err := ArticleFromMarkdown("admonition", "---\ntitle: T\n---\n> [!NOTE]\n> x\n", md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<blockquote>\n<p>[!NOTE]\nx</p>\n</blockquote>\n"; string(article.Content) != want {
+		t.Errorf("disabled admonitions rendered as %s", article.Content)
+	}
+}
+
+func TestFootnotes(t *testing.T) {
+	source := "---\ntitle: T\n---\nText[^1]\n\n[^1]: The note.\n"
+	tests := []struct {
+		name string
+		footnotes bool
+		want string
+	}{
+		{
+			name: "enabled",
+			footnotes: true,
+			want: `<p>Text<sup class="footnote-ref" id="fnref:1"><a href="#fn:1">1</a></sup></p>` + "\n\n" +
+				`<div class="footnotes">` + "\n\n<hr>\n\n<ol>\n" +
+				`<li id="fn:1">The note. <a class="footnote-return" href="#fnref:1"><span aria-label="Back to text">↩</span></a></li>` +
+				"\n</ol>\n\n</div>\n",
+		},
+		{
+			name: "disabled",
+			footnotes: false,
+			want: "<p>Text[^1]</p>\n\n<p>[^1]: The note.</p>\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			md := DefaultMarkdownOptions
+			md.Footnotes = test.footnotes
+			article, err := ArticleFromMarkdown("footnotes", source, md)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(article.Content) != test.want {
+				t.Errorf("content\n%s\nwant\n%s", article.Content, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"strconv"
+	"html/template"
+)
+
+type Pagination struct {
+	Page int
+	// Links to the neighbouring pages, empty when there is none
+	Newer string
+	Older string
+}
+
+func pageURL(page int) string {
+	if page <= 1 {
+		return "/"
+	}
+	return "/page/" + strconv.Itoa(page)
+}
+
+func NewPagination(page int, hasOlder bool) Pagination {
+	pagination := Pagination{Page: page}
+	if page > 1 {
+		pagination.Newer = pageURL(page - 1)
+	}
+	if hasOlder {
+		pagination.Older = pageURL(page + 1)
+	}
+	return pagination
+}
+
+// Options fetching one page of pageSize articles, plus one more to tell
+// whether there is a next page
+func pageListOptions(pageSize int) ListOptions {
+	if pageSize <= 0 {
+		return ListOptions{}
+	}
+	return ListOptions{Limit: pageSize + 1}
+}
+
+// Drops the article fetched to detect the next page
+func splitPage(articles []Article, pageSize int) ([]Article, bool) {
+	if pageSize > 0 && len(articles) > pageSize {
+		return articles[:pageSize], true
+	}
+	return articles, false
+}
+
+type ArchiveMonth struct {
+	Year int
+	Month time.Month
+	URL string
+	ArticleList []articleView
+}
+
+type ArchiveYear struct {
+	Year int
+	URL string
+	Months []ArchiveMonth
+}
+
+// Month 0 is the page of the whole year
+func archiveURL(year int, month time.Month) string {
+	if month == 0 {
+		return fmt.Sprintf("/%04d", year)
+	}
+	return fmt.Sprintf("/%04d/%02d", year, month)
+}
+
+// Range of publish dates shown on an archive page, month 0 covers the whole
+// year
+func ArchiveRange(year int, month time.Month) (since time.Time, until time.Time) {
+	if month == 0 {
+		since = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(1, 0, 0)
+	}
+	since = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return since, since.AddDate(0, 1, 0)
+}
+
+// Groups articles sorted newest first by the year and month they were
+// published
+func GroupArchive(articles []Article) []ArchiveYear {
+	years := make([]ArchiveYear, 0, 4)
+
+	for _, article := range articles {
+		published := article.PublishDate().UTC()
+		year, month := published.Year(), published.Month()
+
+		if len(years) == 0 || years[len(years) - 1].Year != year {
+			years = append(years, ArchiveYear{Year: year, URL: archiveURL(year, 0)})
+		}
+		current := &years[len(years) - 1]
+
+		if len(current.Months) == 0 || current.Months[len(current.Months) - 1].Month != month {
+			current.Months = append(current.Months, ArchiveMonth{Year: year, Month: month, URL: archiveURL(year, month)})
+		}
+		group := &current.Months[len(current.Months) - 1]
+		group.ArticleList = append(group.ArticleList, newArticleView(article))
+	}
+
+	return years
+}
+
+func RenderArchivePage(w io.Writer, tmpl *template.Template, site Site, title string, articles []Article) error {
+	type templateData struct {
+		PageTitle string
+		Years []ArchiveYear
+		Site Site
+	}
+
+	data := templateData{
+		PageTitle: title,
+		Years: GroupArchive(articles),
+		Site: site,
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func archiveTitle(year int, month time.Month) string {
+	switch {
+	case year == 0:
+		return "Archive"
+	case month == 0:
+		return fmt.Sprintf("Archive %d", year)
+	}
+	return fmt.Sprintf("Archive %s %d", month, year)
+}
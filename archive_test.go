@@ -0,0 +1,173 @@
+package main
+
+import (
+	"time"
+	"slices"
+	"strings"
+	"testing"
+	"net/http/httptest"
+)
+
+func articleNames(articles []Article) []string {
+	names := make([]string, 0, len(articles))
+	for _, article := range articles {
+		names = append(names, article.Name)
+	}
+	return names
+}
+
+// Creates articles published on the given days of 2024, in order
+func createDatedArticles(t *testing.T, repo *Repository, dates map[string]string) {
+	t.Helper()
+	names := make([]string, 0, len(dates))
+	for name := range dates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		createTestArticle(t, repo, name, "---\ntitle: " + name + "\ndate: " + dates[name] + "\n---\nText\n")
+	}
+}
+
+func TestListArticles(t *testing.T) {
+	repo := newTestRepository(t)
+	// b and c share a date, the id breaks the tie
+	createDatedArticles(t, repo, map[string]string{
+		"a": "2024-01-10",
+		"b": "2024-02-01",
+		"c": "2024-02-01",
+		"d": "2024-02-20",
+		"e": "2025-01-01T10:30:00Z",
+	})
+
+	c, err := repo.GetArticleByName("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := c.Cursor()
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		names []string
+	}{
+		{"newest first", ListOptions{}, []string{"e", "d", "c", "b", "a"}},
+		{"oldest first", ListOptions{Order: OldestFirst}, []string{"a", "b", "c", "d", "e"}},
+		{"limit", ListOptions{Limit: 2}, []string{"e", "d"}},
+		{"offset", ListOptions{Limit: 2, Offset: 2}, []string{"c", "b"}},
+		{"offset without limit", ListOptions{Offset: 3}, []string{"b", "a"}},
+		{"after cursor", ListOptions{After: &cursor}, []string{"b", "a"}},
+		{"after cursor oldest first", ListOptions{Order: OldestFirst, After: &cursor}, []string{"d", "e"}},
+		{"month", ListOptions{Since: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, []string{"d", "c", "b"}},
+		{"since", ListOptions{Since: time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)}, []string{"e", "d"}},
+		{"until", ListOptions{Until: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, []string{"a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			articles, err := repo.ListArticles(test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := articleNames(articles); !slices.Equal(names, test.names) {
+				t.Errorf("articles %v, want %v", names, test.names)
+			}
+		})
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		page int
+		hasOlder bool
+		want Pagination
+	}{
+		{1, false, Pagination{Page: 1}},
+		{1, true, Pagination{Page: 1, Older: "/page/2"}},
+		{2, true, Pagination{Page: 2, Newer: "/", Older: "/page/3"}},
+		{3, false, Pagination{Page: 3, Newer: "/page/2"}},
+	}
+
+	for _, test := range tests {
+		if got := NewPagination(test.page, test.hasOlder); got != test.want {
+			t.Errorf("NewPagination(%d, %v) = %+v, want %+v", test.page, test.hasOlder, got, test.want)
+		}
+	}
+}
+
+func TestGroupArchive(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time { return time.Date(year, month, d, 0, 0, 0, 0, time.UTC) }
+	articles := []Article{
+		{Name: "d", PublishedAt: day(2025, 1, 1)},
+		{Name: "c", PublishedAt: day(2024, 2, 20)},
+		{Name: "b", PublishedAt: day(2024, 2, 1)},
+		{Name: "a", PublishedAt: day(2024, 1, 10)},
+	}
+
+	years := GroupArchive(articles)
+	groups := make([]string, 0, 4)
+	for _, year := range years {
+		for _, month := range year.Months {
+			names := make([]string, 0, len(month.ArticleList))
+			for _, view := range month.ArticleList {
+				names = append(names, view.Name)
+			}
+			groups = append(groups, month.URL + ":" + strings.Join(names, ","))
+		}
+	}
+
+	want := []string{"/2025/01:d", "/2024/02:c,b", "/2024/01:a"}
+	if !slices.Equal(groups, want) {
+		t.Errorf("groups %v, want %v", groups, want)
+	}
+	if len(years) != 2 || years[0].URL != "/2025" || years[1].URL != "/2024" {
+		t.Errorf("years %+v", years)
+	}
+}
+
+func TestListingPages(t *testing.T) {
+	repo := newTestRepository(t)
+	createDatedArticles(t, repo, map[string]string{
+		"a": "2024-01-10",
+		"b": "2024-02-01",
+		"c": "2024-02-20",
+		"d": "2025-01-01",
+		"e": "2025-01-05",
+	})
+	handler := newTestServer(t, repo, ServerOptions{PageSize: 2})
+
+	tests := []struct {
+		path string
+		status int
+		names []string
+	}{
+		{"/", 200, []string{"e", "d"}},
+		{"/page/2", 200, []string{"c", "b"}},
+		{"/page/3", 200, []string{"a"}},
+		{"/page/4", 404, nil},
+		{"/page/1", 301, nil},
+		{"/archive", 200, []string{"a", "b", "c", "d", "e"}},
+		{"/2024", 200, []string{"a", "b", "c"}},
+		{"/2024/02", 200, []string{"b", "c"}},
+		{"/2024/03", 404, nil},
+		{"/2023", 404, nil},
+		{"/2024/13", 404, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+			if rec.Code != test.status {
+				t.Fatalf("status %d, want %d", rec.Code, test.status)
+			}
+
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				listed := strings.Contains(rec.Body.String(), `href="/article/` + name + `"`)
+				if listed != slices.Contains(test.names, name) {
+					t.Errorf("%s listed: %v", name, listed)
+				}
+			}
+		})
+	}
+}
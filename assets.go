@@ -0,0 +1,240 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+	"errors"
+	"path"
+	"bytes"
+	"strings"
+	"net/http"
+	"io/fs"
+	"mime"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Cache-Control of fingerprinted assets, their URL changes with their content
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// A file of the static directory, also served under a name containing a hash
+// of its contents. The file itself is served from disk, only compressed copies
+// are kept in memory.
+type Asset struct {
+	// Path inside the static directory, with forward slashes
+	Name string
+	Fingerprinted string
+	// Path of the file on disk
+	Path string
+	// Only set for compressible files when they are smaller
+	Gzip []byte
+	Brotli []byte
+	Hash string
+	Size int64
+	ModTime time.Time
+}
+
+type AssetManifest struct {
+	assets map[string]*Asset
+	fingerprinted map[string]*Asset
+	// Hash over every asset, changes whenever an asset does
+	Version string
+	// Newest modification time of any asset
+	ModTime time.Time
+}
+
+// Inserts the hash before the extension, css/style.css becomes
+// css/style.0123456789ab.css
+func fingerprintName(name string, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isCompressibleAsset(name string) bool {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "svg")
+}
+
+// Hashes and compresses every file in dir, an empty manifest is returned when
+// dir does not exist. Files that did not change since previous, which may be
+// nil, are taken from it instead of being read and compressed again.
+func LoadAssets(dir string, previous *AssetManifest) (*AssetManifest, error) {
+	manifest := &AssetManifest{
+		assets: make(map[string]*Asset),
+		fingerprinted: make(map[string]*Asset),
+	}
+	version := sha256.New()
+
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == dir {
+			return fs.SkipAll
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil { return err }
+		name := filepath.ToSlash(rel)
+
+		// Compressed copies are produced here
+		if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".br") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil { return err }
+
+		asset, err := loadAsset(p, name, info, previous)
+		if err != nil { return err }
+
+		manifest.assets[asset.Name] = asset
+		manifest.fingerprinted[asset.Fingerprinted] = asset
+		if asset.ModTime.After(manifest.ModTime) {
+			manifest.ModTime = asset.ModTime
+		}
+		version.Write([]byte(asset.Fingerprinted + "\x00"))
+		return nil
+	})
+	if err != nil { return nil, err }
+
+	manifest.Version = hex.EncodeToString(version.Sum(nil)[:8])
+	return manifest, nil
+}
+
+func loadAsset(p string, name string, info fs.FileInfo, previous *AssetManifest) (*Asset, error) {
+	var old *Asset
+	if previous != nil {
+		old = previous.assets[name]
+	}
+	if old != nil && old.Path == p && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+		return old, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil { return nil, err }
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil { return nil, err }
+
+	asset := &Asset{
+		Name: name,
+		Path: p,
+		Hash: hex.EncodeToString(h.Sum(nil)[:6]),
+		Size: info.Size(),
+		ModTime: info.ModTime(),
+	}
+	asset.Fingerprinted = fingerprintName(name, asset.Hash)
+
+	if !isCompressibleAsset(name) {
+		return asset, nil
+	}
+
+	// Touched but unchanged files keep their compressed copies
+	if old != nil && old.Hash == asset.Hash {
+		asset.Gzip, asset.Brotli = old.Gzip, old.Brotli
+		return asset, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil { return nil, err }
+
+	compressed, err := gzipBytes(data)
+	if err != nil { return nil, err }
+	if len(compressed) < len(data) {
+		asset.Gzip = compressed
+	}
+
+	compressed, err = brotliBytes(data, brotli.BestCompression)
+	if err != nil { return nil, err }
+	if len(compressed) < len(data) {
+		asset.Brotli = compressed
+	}
+	return asset, nil
+}
+
+// URL of an asset for templates, files missing from the manifest keep their
+// plain URL
+func (manifest *AssetManifest) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if manifest != nil {
+		if asset, ok := manifest.assets[name]; ok {
+			return "/static/" + asset.Fingerprinted
+		}
+	}
+	return "/static/" + name
+}
+
+// Serves a fingerprinted asset, name is relative to /static/. Compressed
+// copies come from memory, the file itself from disk. Returns false when name
+// is not a fingerprinted asset.
+func (manifest *AssetManifest) Serve(w http.ResponseWriter, r *http.Request, name string) bool {
+	if manifest == nil {
+		return false
+	}
+	asset, ok := manifest.fingerprinted[name]
+	if !ok {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", immutableCacheControl)
+	if asset.Gzip != nil || asset.Brotli != nil {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	var data []byte
+	etag := asset.Hash
+	switch {
+	case asset.Brotli != nil && acceptsEncoding(r, "br"):
+		header.Set("Content-Encoding", "br")
+		data, etag = asset.Brotli, asset.Hash + "-br"
+	case asset.Gzip != nil && acceptsEncoding(r, "gzip"):
+		header.Set("Content-Encoding", "gzip")
+		data, etag = asset.Gzip, asset.Hash + "-gzip"
+	}
+	header.Set("ETag", `"` + etag + `"`)
+
+	if data == nil {
+		http.ServeFile(w, r, asset.Path)
+		return true
+	}
+
+	// Compressed assets are text, which always has a type for its extension
+	header.Set("Content-Type", mime.TypeByExtension(path.Ext(asset.Name)))
+	http.ServeContent(w, r, "", asset.ModTime, bytes.NewReader(data))
+	return true
+}
+
+// Writes every asset under its fingerprinted name next to .gz and .br copies,
+// the plain names are written by CopyDir
+func (b *SiteBuilder) WriteAssets(manifest *AssetManifest, dest string) error {
+	for _, asset := range manifest.assets {
+		data, err := os.ReadFile(asset.Path)
+		if err != nil { return err }
+
+		err = b.WriteFile(dest + "/" + asset.Fingerprinted, data)
+		if err != nil { return err }
+
+		if asset.Gzip != nil {
+			err = b.WriteFile(dest + "/" + asset.Fingerprinted + ".gz", asset.Gzip)
+			if err != nil { return err }
+		}
+
+		if asset.Brotli != nil {
+			err = b.WriteFile(dest + "/" + asset.Fingerprinted + ".br", asset.Brotli)
+			if err != nil { return err }
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"time"
+	"strings"
+	"testing"
+	"net/http"
+	"path/filepath"
+)
+
+var testStyle = "body {\n" + strings.Repeat("\tcolor: black;\n", 40) + "}\n"
+
+func TestAssetServe(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"style.css": testStyle,
+		"image.png": "\x89PNG not really",
+	})
+
+	assets, err := LoadAssets(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	style := assets.assets["style.css"]
+	image := assets.assets["image.png"]
+	if style.Gzip == nil || style.Brotli == nil {
+		t.Error("text asset has no compressed copies")
+	}
+	if image.Gzip != nil || image.Brotli != nil {
+		t.Error("binary asset has compressed copies")
+	}
+
+	styleName := strings.TrimPrefix(assets.URL("style.css"), "/static/")
+	imageName := strings.TrimPrefix(assets.URL("image.png"), "/static/")
+
+	tests := []struct {
+		name string
+		asset string
+		acceptEncoding string
+		ifNoneMatch string
+		status int
+		encoding string
+		etag string
+		contentType string
+	}{
+		{"brotli", styleName, "gzip, br", "", 200, "br", style.Hash + "-br", "text/css; charset=utf-8"},
+		{"gzip", styleName, "gzip", "", 200, "gzip", style.Hash + "-gzip", "text/css; charset=utf-8"},
+		{"identity from disk", styleName, "", "", 200, "", style.Hash, "text/css; charset=utf-8"},
+		// Not modified responses have no Content-Encoding
+		{"revalidated", styleName, "br", `"` + style.Hash + `-br"`, 304, "", style.Hash + "-br", ""},
+		{"revalidated from disk", styleName, "", `"` + style.Hash + `"`, 304, "", style.Hash, ""},
+		{"binary ignores encodings", imageName, "br", "", 200, "", image.Hash, "image/png"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := requestPage(assetHandler(assets), "/" + test.asset, map[string]string{
+				"Accept-Encoding": test.acceptEncoding,
+				"If-None-Match": test.ifNoneMatch,
+			})
+			header := rec.Header()
+
+			if rec.Code != test.status {
+				t.Errorf("status %d, want %d", rec.Code, test.status)
+			}
+			if got := header.Get("Content-Encoding"); got != test.encoding {
+				t.Errorf("encoding %q, want %q", got, test.encoding)
+			}
+			if got := header.Get("ETag"); got != `"` + test.etag + `"` {
+				t.Errorf("ETag %s, want %q", got, test.etag)
+			}
+			if got := header.Get("Cache-Control"); got != immutableCacheControl {
+				t.Errorf("Cache-Control %q", got)
+			}
+			if test.status == 200 {
+				if got := header.Get("Content-Type"); got != test.contentType {
+					t.Errorf("Content-Type %q, want %q", got, test.contentType)
+				}
+				if test.encoding == "" {
+					data, err := os.ReadFile(assets.fingerprinted[test.asset].Path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if rec.Body.String() != string(data) {
+						t.Errorf("body %q, want the file", rec.Body.String())
+					}
+				}
+			}
+		})
+	}
+
+	rec := requestPage(assetHandler(assets), "/style.css", nil)
+	if rec.Code != 404 {
+		t.Errorf("plain name served by the manifest with status %d", rec.Code)
+	}
+}
+
+// Serves fingerprinted assets, everything else is not found
+func assetHandler(assets *AssetManifest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		if !assets.Serve(w, r, strings.TrimPrefix(r.URL.Path, "/")) {
+			httpError(w, 404)
+		}
+	})
+}
+
+func TestLoadAssetsReuse(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"style.css": testStyle, "app.js": "let a = 1;\n"})
+	stylePath := filepath.Join(dir, "style.css")
+
+	first, err := LoadAssets(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Touched without changes, the compressed copies are kept
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(stylePath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadAssets(dir, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.assets["app.js"] != second.assets["app.js"] {
+		t.Error("unchanged asset loaded again")
+	}
+	style := second.assets["style.css"]
+	if &style.Brotli[0] != &first.assets["style.css"].Brotli[0] {
+		t.Error("touched asset compressed again")
+	}
+	if !style.ModTime.Equal(later) || second.Version != first.Version {
+		t.Errorf("touched asset has modification time %v and version %s, want %v and %s", style.ModTime, second.Version, later, first.Version)
+	}
+
+	// Changed, fingerprint and copies follow the new contents
+	writeTestFiles(t, dir, map[string]string{"style.css": testStyle + "p {}\n"})
+	third, err := LoadAssets(dir, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.assets["style.css"].Hash == style.Hash || third.Version == second.Version {
+		t.Error("changed asset kept its hash")
+	}
+	if got := decodeBody(t, "br", third.assets["style.css"].Brotli); got != testStyle + "p {}\n" {
+		t.Errorf("brotli copy %q is stale", got)
+	}
+}
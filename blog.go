@@ -5,10 +5,20 @@ import (
 	"time"
 	"errors"
 	"os"
+	"os/signal"
+	"flag"
 	"fmt"
 	"path/filepath"
 	"strings"
+	"slices"
 	"database/sql"
+	"database/sql/driver"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/url"
+	"encoding/json"
 	"html/template"
 	_ "embed"
 
@@ -19,9 +29,6 @@ import (
 	"github.com/gomarkdown/markdown/parser"
 	"github.com/gomarkdown/markdown/html"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-
 	"github.com/jmoiron/sqlx"
 )
 
@@ -31,20 +38,101 @@ type Article struct {
 	Title HTML
 	RawTitle string
 	Content HTML
+	Summary HTML
+	Text string
+	Description string
+	Author string
+	Tags StringList
+	PublishedAt time.Time
+	Draft bool
+	Extra Metadata
+	TOC TableOfContents
+	ArticleStats
+	Hash string
+	// File name of the markdown source inside the articles directory
+	Source string
+	// Archived after its source was removed
+	Deleted bool
+	// Markdown source, only set when loaded from a file
+	Markdown string `db:"-"`
 	UpdatedAt time.Time
 	CreatedAt time.Time
 }
 
+// Drafts and archived articles are never published, other articles are published once PublishedAt
+// has passed.
+func (article Article) IsPublished(now time.Time) bool {
+	return !article.Draft && !article.Deleted && !article.PublishedAt.After(now)
+}
+
+// Date shown to readers, the front matter date if there is one
+func (article Article) PublishDate() time.Time {
+	if article.PublishedAt.IsZero() {
+		return article.CreatedAt
+	}
+	return article.PublishedAt
+}
+
+func sortArticlesNewestFirst(articles []Article) []Article {
+	sorted := slices.Clone(articles)
+	slices.SortStableFunc(sorted, func(a, b Article) int {
+		return b.PublishDate().Compare(a.PublishDate())
+	})
+	return sorted
+}
+
+// List of strings stored as a JSON array
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+func (l *StringList) Scan(src any) error {
+	return scanJSON(src, l)
+}
+
+// Free form front matter fields stored as a JSON object
+type Metadata map[string]any
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]any(m))
+	return string(data), err
+}
+
+func (m *Metadata) Scan(src any) error {
+	return scanJSON(src, m)
+}
+
+func scanJSON(src any, dest any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case []byte:
+		return json.Unmarshal(v, dest)
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
 type Repository struct {
 	db *sqlx.DB
+	fts bool
 }
 
 var IdNotFoundErr error = errors.New("id does not exist")
 
-//go:embed schema.sql
-var DB_SCHEMA string
-
-func NewRepository(dbConn string) (*Repository, error){
+// Opens the database without touching its schema
+func OpenRepository(dbConn string) (*Repository, error){
 	repo := &Repository{}
 	db, err := sqlx.Open("sqlite3", dbConn)
 	if err != nil { return nil, err }
@@ -52,33 +140,79 @@ func NewRepository(dbConn string) (*Repository, error){
 	db.MapperFunc(func (s string) string {
 		return s
 	})
-	db.MustExec(DB_SCHEMA)
 
 	repo.db = db
 	return repo, nil
 }
 
+// Opens the database and brings its schema up to date
+func NewRepository(dbConn string) (*Repository, error){
+	repo, err := OpenRepository(dbConn)
+	if err != nil { return nil, err }
+
+	_, err = repo.Migrate()
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+
+	err = repo.initSearch()
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
 func (repo *Repository) Close(){
 	repo.db.Close()
 }
 
 func (repo *Repository) CreateArticle(article Article) (id int64, err error) {
-	res, err := repo.db.Exec(`
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
 		INSERT INTO Article(
-			Name, Title, RawTitle, Content,
-			CreatedAt, UpdatedAt
+			Name, Title, RawTitle, Content, Summary, Text,
+			Description, Author, Tags, PublishedAt, Draft, Extra,
+			TOC, WordCount, ReadingMinutes, CodeBlocks, Images,
+			Hash, Source, CreatedAt, UpdatedAt
 		)
 		VALUES (
-			?, ?, ?, ?,
-			CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+			?, ?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?,
+			?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
 		)
-	`, article.Name, article.Title, article.RawTitle, article.Content)
+	`, article.Name, article.Title, article.RawTitle, article.Content, article.Summary, article.Text,
+		article.Description, article.Author, article.Tags, article.PublishedAt, article.Draft, article.Extra,
+		article.TOC, article.WordCount, article.ReadingMinutes, article.CodeBlocks, article.Images,
+		article.Hash, article.Source)
 
 	if err != nil {
 		return -1, err
 	}
 
 	id, err = res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+
+	err = setArticleTags(tx, id, article.Tags)
+	if err != nil {
+		return -1, err
+	}
+
+	err = addArticleRevision(tx, id, article)
+	if err != nil {
+		return -1, err
+	}
+
+	err = tx.Commit()
 	return
 }
 
@@ -121,17 +255,48 @@ func (repo *Repository) GetArticleById(id int64) (Article, error){
 	return article, err
 }
 func (repo *Repository) UpdateArticle(article Article) error {
-	res, err := repo.db.Exec(`
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
 		UPDATE
 			Article
 		SET
 			 Name = ?
 			,Title = ?
+			,RawTitle = ?
 			,Content = ?
-			,UpdatedAt = CURRENT_TIMESTAMP
+			,Summary = ?
+			,Text = ?
+			,Description = ?
+			,Author = ?
+			,Tags = ?
+			,PublishedAt = ?
+			,Draft = ?
+			,Extra = ?
+			,TOC = ?
+			,WordCount = ?
+			,ReadingMinutes = ?
+			,CodeBlocks = ?
+			,Images = ?
+			,Hash = ?
+			,Source = ?
+			,Deleted = 0
+			,UpdatedAt = CASE
+				WHEN Title <> ? OR Content <> ? OR Draft <> ? OR Deleted <> 0
+					OR datetime(PublishedAt) IS NOT datetime(?) THEN CURRENT_TIMESTAMP
+				ELSE UpdatedAt
+			END
 		WHERE
 			Id = ?
-	`, article.Name, article.Title, article.Content, article.Id)
+	`, article.Name, article.Title, article.RawTitle, article.Content, article.Summary, article.Text,
+		article.Description, article.Author, article.Tags, article.PublishedAt, article.Draft, article.Extra,
+		article.TOC, article.WordCount, article.ReadingMinutes, article.CodeBlocks, article.Images,
+		article.Hash, article.Source, article.Title, article.Content, article.Draft, article.PublishedAt,
+		article.Id)
 
 	if err != nil {
 		return err
@@ -141,13 +306,51 @@ func (repo *Repository) UpdateArticle(article Article) error {
 		return IdNotFoundErr
 	}
 
+	err = setArticleTags(tx, article.Id, article.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = addArticleRevision(tx, article.Id, article)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Overwrites the creation and update dates of an article, used when importing
+// dates from elsewhere.
+func (repo *Repository) SetArticleDates(name string, createdAt time.Time, updatedAt time.Time) error {
+	res, err := repo.db.Exec(`
+		UPDATE
+			Article
+		SET
+			 CreatedAt = ?
+			,UpdatedAt = ?
+		WHERE
+			Name = ?
+	`, createdAt.UTC(), updatedAt.UTC(), name)
+
+	if err != nil {
+		return err
+	}
+
+	if count, _ := res.RowsAffected(); count < 1 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
 
-func (repo *Repository) DeleteArticle(article Article) error {
+// Hides an article without losing it, it is restored by the next update
+func (repo *Repository) ArchiveArticle(article Article) error {
 	_, err := repo.db.Exec(`
-		DELETE FROM
+		UPDATE
 			Article
+		SET
+			 Deleted = 1
+			,UpdatedAt = CURRENT_TIMESTAMP
 		WHERE
 			Id = ?
 	`, article.Id)
@@ -155,17 +358,191 @@ func (repo *Repository) DeleteArticle(article Article) error {
 	return err
 }
 
-func (repo *Repository) ListArticles() ([]Article, error){
-	rows, err := repo.db.Queryx(`
+func (repo *Repository) DeleteArticle(article Article) error {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM
+			Article
+		WHERE
+			Id = ?
+	`, article.Id)
+
+	if err != nil {
+		return err
+	}
+
+	err = setArticleTags(tx, article.Id, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM
+			ArticleRevision
+		WHERE
+			ArticleId = ?
+	`, article.Id)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type ArticleOrder int
+
+const (
+	NewestFirst ArticleOrder = iota
+	OldestFirst
+)
+
+// Position of an article in a listing, lets a listing continue after it
+// without counting the rows before
+type ArticleCursor struct {
+	PublishDate time.Time
+	Id int64
+}
+
+func (article Article) Cursor() ArticleCursor {
+	return ArticleCursor{PublishDate: article.PublishDate(), Id: article.Id}
+}
+
+// Listings are ordered by PublishDate, the date shown in article lists
+type ListOptions struct {
+	Order ArticleOrder
+	// 0 means no limit
+	Limit int
+	Offset int
+	// Only articles that come after the cursor in Order
+	After *ArticleCursor
+	// Only articles published in [Since, Until), zero times are unbounded
+	Since time.Time
+	Until time.Time
+}
+
+// PublishDate() in SQL. Dates are stored in more than one format, datetime()
+// normalizes them.
+const publishDateExpr = "datetime(CASE WHEN datetime(Article.PublishedAt) > '0001-01-01 00:00:00' " +
+	"THEN Article.PublishedAt ELSE Article.CreatedAt END)"
+const sqliteDateTime = "2006-01-02 15:04:05"
+
+func (repo *Repository) ListArticles(opts ListOptions) ([]Article, error){
+	return repo.listArticles("", nil, opts)
+}
+
+func (repo *Repository) listArticles(condition string, args []any, opts ListOptions) ([]Article, error){
+	conditions := make([]string, 0, 4)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+
+	if !opts.Since.IsZero() {
+		conditions = append(conditions, publishDateExpr + " >= ?")
+		args = append(args, opts.Since.UTC().Format(sqliteDateTime))
+	}
+	if !opts.Until.IsZero() {
+		conditions = append(conditions, publishDateExpr + " < ?")
+		args = append(args, opts.Until.UTC().Format(sqliteDateTime))
+	}
+
+	compare, direction := "<", "DESC"
+	if opts.Order == OldestFirst {
+		compare, direction = ">", "ASC"
+	}
+
+	if opts.After != nil {
+		publishDate := opts.After.PublishDate.UTC().Format(sqliteDateTime)
+		conditions = append(conditions, "(" + publishDateExpr + " " + compare + " ? OR (" +
+			publishDateExpr + " = ? AND Article.Id " + compare + " ?))")
+		args = append(args, publishDate, publishDate, opts.After.Id)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit, opts.Offset)
+
+	return repo.queryArticles(`
 		SELECT
 			*
 		FROM
 			Article
+		` + where + `
+		ORDER BY
+			` + publishDateExpr + ` ` + direction + `, Article.Id ` + direction + `
+		LIMIT ? OFFSET ?
+	`, args...)
+}
+
+// Filters out drafts, archived articles and those with a future publish date,
+// takes the current time as parameter.
+const publishedCondition = `Article.Draft = 0 AND Article.Deleted = 0 AND Article.PublishedAt <= ?`
+
+// Lists articles that are not drafts and whose publish date has passed
+func (repo *Repository) ListPublishedArticles(opts ListOptions) ([]Article, error){
+	return repo.listArticles(publishedCondition, []any{time.Now().UTC()}, opts)
+}
+
+// Publish date of the next scheduled article, zero if there is none
+func (repo *Repository) NextPublication(now time.Time) (time.Time, error){
+	var next time.Time
+	err := repo.db.Get(&next, `
+		SELECT
+			PublishedAt
+		FROM
+			Article
+		WHERE
+			Draft = 0 AND Deleted = 0 AND PublishedAt > ?
+		ORDER BY
+			PublishedAt
+		LIMIT 1
+	`, now.UTC())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return next, err
+}
+
+// Latest edit of any article, including drafts and archived articles, which
+// changes the lists they are removed from
+func (repo *Repository) LastChange() (time.Time, error){
+	var last time.Time
+	err := repo.db.Get(&last, `
+		SELECT
+			UpdatedAt
+		FROM
+			Article
+		ORDER BY
+			datetime(UpdatedAt) DESC
+		LIMIT 1
 	`)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return last, err
+}
+
+func (repo *Repository) queryArticles(query string, args ...any) ([]Article, error){
+	rows, err := repo.db.Queryx(query, args...)
+
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	articles := make([]Article, 0, 8)
 
@@ -180,12 +557,162 @@ func (repo *Repository) ListArticles() ([]Article, error){
 		articles = append(articles, article)
 	}
 
-	return articles, nil
+	return articles, rows.Err()
+}
+
+type TagCount struct {
+	Name string
+	Count int
+}
+
+// Replaces the tags of an article, tags no longer used by any article are
+// removed.
+func setArticleTags(tx *sqlx.Tx, articleId int64, tags []string) error {
+	_, err := tx.Exec(`
+		DELETE FROM
+			ArticleTag
+		WHERE
+			ArticleId = ?
+	`, articleId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO Tag(Name) VALUES (?)
+		`, tag)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO ArticleTag(ArticleId, TagId)
+			SELECT ?, Id FROM Tag WHERE Name = ?
+		`, articleId, tag)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM
+			Tag
+		WHERE
+			Id NOT IN (SELECT TagId FROM ArticleTag)
+	`)
+
+	return err
+}
+
+// Lists tags of published articles
+func (repo *Repository) ListTags() ([]TagCount, error){
+	tags := make([]TagCount, 0, 16)
+
+	err := repo.db.Select(&tags, `
+		SELECT
+			 Tag.Name AS Name
+			,count(*) AS Count
+		FROM
+			Tag
+			INNER JOIN ArticleTag ON ArticleTag.TagId = Tag.Id
+			INNER JOIN Article ON Article.Id = ArticleTag.ArticleId
+		WHERE
+			` + publishedCondition + `
+		GROUP BY
+			Tag.Id
+		ORDER BY
+			Tag.Name
+	`, time.Now().UTC())
+
+	return tags, err
 }
 
-const markdownExtensions = parser.NoIntraEmphasis | parser.Tables | parser.FencedCode |
-	parser.Autolink | parser.Strikethrough | parser.SpaceHeadings | parser.HeadingIDs |
-	parser.BackslashLineBreak | parser.DefinitionLists | parser.AutoHeadingIDs
+// Lists published articles with the given tag
+func (repo *Repository) ListArticlesByTag(tag string) ([]Article, error){
+	return repo.queryArticles(`
+		SELECT
+			Article.*
+		FROM
+			Article
+			INNER JOIN ArticleTag ON ArticleTag.ArticleId = Article.Id
+			INNER JOIN Tag ON Tag.Id = ArticleTag.TagId
+		WHERE
+			Tag.Name = ? AND ` + publishedCondition + `
+		ORDER BY
+			` + publishDateExpr + ` DESC, Article.Id DESC
+	`, NormalizeTag(tag), time.Now().UTC())
+}
+
+// Tags are path segments of /tag/<name>, so slashes become dashes
+func NormalizeTag(tag string) string {
+	tag = strings.NewReplacer("/", "-", `\`, "-").Replace(tag)
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// Path of the page of a tag, also a template function
+func tagURL(tag string) string {
+	return "/tag/" + url.PathEscape(tag)
+}
+
+func normalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// Extensions that are always enabled, MarkdownOptions adds the others
+const markdownExtensions = parser.NoIntraEmphasis | parser.FencedCode | parser.Autolink |
+	parser.SpaceHeadings | parser.HeadingIDs | parser.BackslashLineBreak | parser.AutoHeadingIDs
+
+// Optional markdown features, set in the [markdown] table of blog.toml
+type MarkdownOptions struct {
+	Tables bool
+	Strikethrough bool
+	DefinitionLists bool
+	Footnotes bool
+	Math bool
+	Admonitions bool
+	Highlight bool
+}
+
+var DefaultMarkdownOptions = MarkdownOptions{
+	Tables: true,
+	Strikethrough: true,
+	DefinitionLists: true,
+	Footnotes: true,
+	Math: true,
+	Admonitions: true,
+	Highlight: true,
+}
+
+func (md MarkdownOptions) Extensions() parser.Extensions {
+	extensions := parser.Extensions(markdownExtensions)
+	optional := []struct {
+		enabled bool
+		extension parser.Extensions
+	}{
+		{md.Tables, parser.Tables},
+		{md.Strikethrough, parser.Strikethrough},
+		{md.DefinitionLists, parser.DefinitionLists},
+		{md.Footnotes, parser.Footnotes},
+		{md.Math, parser.MathJax},
+	}
+	for _, option := range optional {
+		if option.enabled {
+			extensions |= option.extension
+		}
+	}
+	return extensions
+}
 
 func remove[T any](s []T, i int) []T {
 	return append(s[:i], s[i+1:]...)
@@ -216,62 +743,60 @@ func RenderMarkdownToHtml(source string) string {
 	return string(html);
 }
 
-func LoadArticlesFromDirectory(dirpath string, repo *Repository) error {
-	files, err := ListDirectoryMarkdownFiles(dirpath)
-	if err != nil { return err }
-
-	for _, file := range files {
-		article, err := LoadArticleFromFile(file)
-		if err != nil {
-			log.Println("Error loading file:", err.Error())
-			continue
-		}
-
-		if dbArticle, err := repo.GetArticleByName(article.Name); err == nil {
-			log.Println("Update", article.Name)
-
-			article.Id = dbArticle.Id
-			err := repo.UpdateArticle(article)
-			if err != nil {
-				log.Println("Failed to update article", err.Error())
-				continue
-			}
-
-		} else if err == sql.ErrNoRows {
-			log.Println("Create", article.Name)
-
-			_, err := repo.CreateArticle(article)
-			if err != nil {
-				log.Println("Failed to create article", err.Error())
-				continue
-			}
-
-		} else {
-			log.Fatal(err.Error())
-			continue
-		}
-
+// Bump whenever changes to the markdown pipeline alter the rendered output, so
+// that articles with unchanged sources get rendered again.
+const rendererVersion = 11
+
+// Options other than the defaults are part of the hash, so articles get
+// rendered again when they change
+func HashArticleSource(source string, md MarkdownOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00", rendererVersion)
+	if md != DefaultMarkdownOptions {
+		fmt.Fprintf(h, "%+v\x00", md)
 	}
-
-	return nil
+	io.WriteString(h, source)
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func ArticleFromMarkdown(name string, source string) Article {
+func ArticleFromMarkdown(name string, source string, md MarkdownOptions) (Article, error) {
 	article := Article{
 		Name: name,
 		RawTitle: name,
-		Title: template.HTML(name),
+		Title: template.HTML(template.HTMLEscapeString(name)),
+		Hash: HashArticleSource(source, md),
+		Markdown: source,
+	}
+
+	fm, body, err := ParseFrontMatter(source)
+	if err != nil {
+		return article, err
 	}
 
-	parser := parser.NewWithExtensions(markdownExtensions)
+	if fm.Slug != "" {
+		article.Name = fm.Slug
+	}
+	article.Description = fm.Description
+	article.Author = fm.Author
+	article.Tags = normalizeTags(fm.Tags)
+	article.PublishedAt = fm.Date
+	article.Draft = fm.Draft
+	article.Extra = fm.Extra
+
+	parser := parser.NewWithExtensions(md.Extensions())
+	if md.Math {
+		parser.RegisterInline('$', parseInlineMath)
+	}
 
-	root := markdown.Parse([]byte(source), parser).(*ast.Document)
+	root := markdown.Parse([]byte(body), parser).(*ast.Document)
 
-	opts := html.RendererOptions{Flags: html.CommonFlags | html.HrefTargetBlank}
-	renderer := html.NewRenderer(opts)
+	renderer := html.NewRenderer(md.rendererOptions())
 
-	heading := PopFirstHeading(root)
-	if heading != nil {
+	if fm.Title != "" {
+		// An explicit title leaves the first heading as part of the body
+		article.Title = template.HTML(template.HTMLEscapeString(fm.Title))
+		article.RawTitle = fm.Title
+	} else if heading := PopFirstHeading(root); heading != nil {
 		hRoot := ast.Document{}
 		hRoot.Children = make([]ast.Node, len(heading.Children))
 		copy(hRoot.Children, heading.Children)
@@ -280,9 +805,50 @@ func ArticleFromMarkdown(name string, source string) Article {
 		article.RawTitle = ExtractRawText(&hRoot)
 	}
 
+	if md.Admonitions {
+		ReplaceAdmonitions(root)
+	}
+
+	article.TOC = BuildTableOfContents(root, fm.TOCDepth)
+	article.TOC.Inline = ReplaceTOCMarkers(root, &article.TOC)
+
 	article.Content = template.HTML(markdown.Render(root, renderer))
+	article.Text = ExtractRawText(root)
+	article.Summary = BuildSummary(root, md, fm.Description, article.Text)
+	article.ArticleStats = ComputeArticleStats(root)
 
-	return article
+	return article, nil
+}
+
+func (md MarkdownOptions) rendererOptions() html.RendererOptions {
+	return html.RendererOptions{
+		Flags: html.CommonFlags | html.HrefTargetBlank | html.FootnoteReturnLinks,
+		FootnoteReturnLinkContents: `<span aria-label="Back to text">↩</span>`,
+		RenderNodeHook: md.renderHook,
+	}
+}
+
+// Replaces the default rendering of some nodes
+func (md MarkdownOptions) renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *ast.CodeBlock:
+		if !md.Highlight {
+			return ast.GoToNext, false
+		}
+		return renderCodeBlock(w, node)
+	case *tocNode:
+		return renderTOCNode(w, node)
+	case *admonitionNode:
+		return renderAdmonition(w, node, entering)
+	case *ast.Math:
+		return renderMath(w, string(node.Literal), false)
+	case *ast.MathBlock:
+		if !entering {
+			return ast.GoToNext, true
+		}
+		return renderMath(w, string(node.Literal), true)
+	}
+	return ast.GoToNext, false
 }
 
 func ExtractRawText(node ast.Node) string {
@@ -310,7 +876,7 @@ func extractRawTextRec(node ast.Node, sb *strings.Builder){
 
 type HTML = template.HTML
 
-func LoadArticleFromFile(path string) (article Article, err error) {
+func LoadArticleFromFile(path string, md MarkdownOptions) (article Article, err error) {
 	var data []byte
 
 	data, err = os.ReadFile(path)
@@ -320,10 +886,45 @@ func LoadArticleFromFile(path string) (article Article, err error) {
 	ext := filepath.Ext(basename)
 	name := basename[:len(basename) - len(ext)]
 
-	article = ArticleFromMarkdown(name, string(data))
+	article, err = ArticleFromMarkdown(name, string(data), md)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	article.Source = basename
 	return
 }
 
+type PublishTimestamp struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Seeds article dates from a publish_dates.json file, as written by the
+// in-memory version of the blog. Articles must already be loaded.
+func ImportPublishDates(path string, repo *Repository) error {
+	data, err := os.ReadFile(path)
+	if err != nil { return err }
+
+	timestamps := make(map[string]PublishTimestamp)
+	err = json.Unmarshal(data, &timestamps)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, timestamp := range timestamps {
+		err := repo.SetArticleDates(name, timestamp.CreatedAt, timestamp.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Println("Skip", name, "(no such article)")
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Println("Import dates", name)
+	}
+
+	return nil
+}
+
 func ListDirectoryMarkdownFiles(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil { return nil, err }
@@ -345,6 +946,27 @@ var articleTemplateData []byte
 //go:embed index.html
 var indexTemplateData []byte
 
+//go:embed tag.html
+var tagTemplateData []byte
+
+//go:embed tags.html
+var tagsTemplateData []byte
+
+//go:embed search.html
+var searchTemplateData []byte
+
+//go:embed history.html
+var historyTemplateData []byte
+
+//go:embed archive.html
+var archiveTemplateData []byte
+
+//go:embed blog.toml
+var configData []byte
+
+//go:embed robots.txt
+var robotsTemplateData []byte
+
 //go:embed style.css
 var styleSheetData []byte
 
@@ -358,24 +980,42 @@ func InitProjectTree(baseDir string) error {
 	defaultFiles := map[string][]byte {
 		"templates/index.html": indexTemplateData,
 		"templates/article.html": articleTemplateData,
+		"templates/tag.html": tagTemplateData,
+		"templates/tags.html": tagsTemplateData,
+		"templates/search.html": searchTemplateData,
+		"templates/history.html": historyTemplateData,
+		"templates/archive.html": archiveTemplateData,
+		"templates/robots.txt": robotsTemplateData,
+		"blog.toml": configData,
 		"static/style.css": styleSheetData,
 	}
 
 	for _, dir := range dirs {
 		p := filepath.Join(baseDir, dir)
 		log.Println("Create", p)
-		err := os.MkdirAll(p, 0o644)
+		err := os.MkdirAll(p, 0o755)
 		if err != nil {
 			log.Println("Failed to create directory: ", err.Error())
 			return err
 		}
 	}
 
+	// Files that already exist are kept, init never overwrites a blog's
+	// templates or settings
 	for path, data := range defaultFiles {
-		// TODO: check if exists
 		p := filepath.Join(baseDir, path)
-		log.Println("Create", p)
-		err := os.WriteFile(p, data, 0o644)
+		file, err := os.OpenFile(p, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			log.Println("Skip", p, "(already exists)")
+			continue
+		}
+		if err == nil {
+			log.Println("Create", p)
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
 
 		if err != nil {
 			log.Println("Failed to create a default file: ", err.Error())
@@ -388,11 +1028,71 @@ func InitProjectTree(baseDir string) error {
 
 func PrintHelp(){
 	lines := []string {
-		"usage: blog <command> [args]",
+		"usage: blog <command> [flags] [args]",
 		"",
 		"commands:",
 		"  init            initialize a blog on current working directory",
-		"  serve <addr>    serve blog at current directory on <addr>",
+		"  serve [--watch] [addr]",
+		"                  serve blog at current directory on addr, or the",
+		"                  configured address, with --watch changes to",
+		"                  articles, templates and static files are picked up",
+		"                  and open pages reloaded",
+		"                  SIGHUP syncs articles and reloads templates,",
+		"                  SIGINT and SIGTERM stop after open requests finish",
+		"  build [--force] <outdir>",
+		"                  render the blog to static files in <outdir>, needs",
+		"                  base_url to be set, files of the previous build",
+		"                  that are gone are removed, --force builds into a",
+		"                  non-empty directory that was not built before",
+		"  sync [--dry-run] [--removal=<policy>]",
+		"                  sync the database with the articles directory and",
+		"                  report the changes",
+		"  import-dates [file]",
+		"                  seed article dates from a publish_dates.json file",
+		"  stats [--json]  print word counts, reading times, code blocks and",
+		"                  images of each article and in total",
+		"  db migrate      apply pending database migrations",
+		"  db status       list database migrations and whether they are applied",
+		"",
+		"search:",
+		"  /search uses SQLite full text search (FTS5) when the binary is built",
+		"  with 'go build -tags sqlite_fts5', otherwise a simple substring",
+		"  search. The backend in use is logged at startup.",
+		"",
+		"configuration:",
+		"  Settings are read from blog.toml, or the file given with --config or",
+		"  BLOG_CONFIG. Environment variables override the file and flags",
+		"  override both, every setting has a flag named like its key with",
+		"  dashes, e.g. --base-url or --markdown-math=false. Run",
+		"  'blog <command> --help' to list them.",
+		"",
+		"environment:",
+		"  BLOG_TITLE, BLOG_DESCRIPTION, BLOG_AUTHOR",
+		"                      site title, description and default author",
+		"  BLOG_BASE_URL       absolute URL of the blog used in feeds, defaults",
+		"                      to the host of each request",
+		"  BLOG_ADDRESS        listen address of serve (default ':8080')",
+		"  BLOG_DATABASE       path of the database (default 'blog.db')",
+		"  BLOG_ARTICLES_DIR, BLOG_TEMPLATES_DIR, BLOG_STATIC_DIR",
+		"                      directories of the blog",
+		"  BLOG_PREVIEW_TOKEN  secret that allows viewing drafts and scheduled",
+		"                      articles with /article/<name>?preview=<token>",
+		"  BLOG_FEED_CONTENT   'full' (default) or 'excerpt'",
+		"  BLOG_FEED_LIMIT     entries per feed (default 20)",
+		"  BLOG_PAGE_SIZE      articles per index page (default 10)",
+		"  BLOG_REMOVAL_POLICY what happens to articles whose file was removed:",
+		"                      'archive' (default, answered with 410 Gone),",
+		"                      'delete' or 'keep'",
+		"  BLOG_CACHE_PAGES    Cache-Control of index, archive, tag and search",
+		"                      pages, empty sends none (default 'no-cache')",
+		"  BLOG_CACHE_ARTICLES Cache-Control of articles (default 'no-cache')",
+		"  BLOG_CACHE_FEEDS    Cache-Control of feeds, sitemaps and robots.txt",
+		"                      (default 'public, max-age=900')",
+		"  BLOG_CACHE_STATIC   Cache-Control of static files",
+		"                      (default 'public, max-age=3600')",
+		"  BLOG_PAGE_CACHE_SIZE",
+		"                      rendered pages kept in memory, 0 disables the",
+		"                      page cache (default 512)",
 	}
 
 	for _, line := range lines {
@@ -400,45 +1100,57 @@ func PrintHelp(){
 	}
 }
 
-func getCLIArg(idx int) string {
-	if idx >= len(os.Args) {
-		PrintHelp()
-		os.Exit(1)
+// Loads the configuration and parses the flags of a command over it. Flags
+// may come before and after the positional arguments, of which the command
+// takes at most maxArgs.
+func loadConfig(flags *flag.FlagSet, args []string, maxArgs int) (Config, []string) {
+	config, err := LoadConfig(configPath(args))
+	if err != nil {
+		log.Fatal(err.Error())
 	}
-	return os.Args[idx]
-}
 
-func Serve(address string) *chi.Router {
-	log.Println("Router setup")
-	router := chi.NewRouter()
-	router.Use(middleware.Compress(5))
-	fileServer := http.FileServer(http.Dir("./static"))
+	config.RegisterFlags(flags)
 
-	repo := NewRepository()
-
-
-	router.Get("/", func(w http.ResponseWriter, r *http.Request){
-		RenderIndexPage(w, "The Blog", repo.GetArticleList())
-	})
-
-	router.Handle("/static/*", http.StripPrefix("/static/", fileServer))
-
-	router.Get("/article/{name}", func(w http.ResponseWriter, r *http.Request){
-		name := chi.URLParam(r, "name")
-
-		if article, ok := repo.GetArticle(name); ok {
-			RenderArticle(w, article)
-		} else {
-			http.Error(w, http.StatusText(404), 404)
+	// The flag package stops at the first positional argument, parsing
+	// resumes after it
+	positional := make([]string, 0, maxArgs)
+	for len(args) > 0 {
+		flags.Parse(args)
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
 		}
-	})
+		// Everything after "--" is positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed - 1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
 
-	router.Get("/timestamps", func(w http.ResponseWriter, r *http.Request){
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(repo.ExportPublishingTimestamps())
-	})
+	if len(positional) > maxArgs {
+		fmt.Fprintf(flags.Output(), "%s: unexpected arguments %q\n", flags.Name(), positional[maxArgs:])
+		flags.Usage()
+		os.Exit(2)
+	}
+	return config, positional
+}
 
-	return router
+func serverOptions(config Config) ServerOptions {
+	opts, err := config.ServerOptions()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return opts
+}
+
+func getCLIArg(idx int) string {
+	if idx >= len(os.Args) {
+		PrintHelp()
+		os.Exit(1)
+	}
+	return os.Args[idx]
 }
 
 func spawnKeyboardInterruptHandler(){
@@ -454,22 +1166,201 @@ func spawnKeyboardInterruptHandler(){
 
 func main(){
 	cmd := getCLIArg(1)
-	spawnKeyboardInterruptHandler()
+	// The server shuts down on its own
+	if cmd != "serve" {
+		spawnKeyboardInterruptHandler()
+	}
 
 	switch cmd {
 	case "init":
 		InitProjectTree(".")
 	
 	case "serve":
-		addr := getCLIArg(2)
+		flags := flag.NewFlagSet("serve", flag.ExitOnError)
+		watch := flags.Bool("watch", false, "reload articles, templates and open pages on changes")
+		config, args := loadConfig(flags, os.Args[2:], 1)
+
+		if len(args) > 0 {
+			config.Address = args[0]
+		}
+
+		opts := serverOptions(config)
+		opts.Watch = *watch
 
 		log.Println("Intialize database")
-		repo, err := NewRepository("blog.db")
+		repo, err := NewRepository(config.Database)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer repo.Close()
+
+		log.Println("Load articles")
+		SyncArticles(opts.ArticlesDir, repo, opts.Sync)
+
+		err = Serve(config.Address, repo, opts)
+		if err != nil {
+			repo.Close()
+			log.Fatal(err.Error())
+		}
+		log.Println("Close database")
+
+	case "build":
+		flags := flag.NewFlagSet("build", flag.ExitOnError)
+		force := flags.Bool("force", false, "build into a non-empty directory without a build manifest")
+		config, args := loadConfig(flags, os.Args[2:], 1)
+		opts := serverOptions(config)
+
+		if len(args) == 0 || args[0] == "" {
+			PrintHelp()
+			os.Exit(1)
+		}
+		outDir := args[0]
+
+		repo, err := NewRepository(config.Database)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+		defer repo.Close()
+
 		log.Println("Load articles")
-		LoadArticlesFromDirectory("articles", repo)
+		SyncArticles(opts.ArticlesDir, repo, opts.Sync)
+
+		log.Println("Load static assets")
+		assets, err := LoadAssets(opts.StaticDir, nil)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		log.Println("Load templates")
+		templates, err := LoadTemplates(opts.TemplatesDir, assets)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		err = BuildSite(outDir, *force, repo, templates, opts)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+	case "sync":
+		flags := flag.NewFlagSet("sync", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only report what would change")
+		config, _ := loadConfig(flags, os.Args[2:], 0)
+
+		syncOpts, err := config.SyncOptions()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		syncOpts.DryRun = *dryRun
+
+		repo, err := NewRepository(config.Database)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer repo.Close()
+
+		report, err := SyncArticles(config.ArticlesDir, repo, syncOpts)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		report.Print(os.Stdout)
+
+	case "import-dates":
+		flags := flag.NewFlagSet("import-dates", flag.ExitOnError)
+		config, args := loadConfig(flags, os.Args[2:], 1)
+		opts := serverOptions(config)
+
+		path := "publish_dates.json"
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		repo, err := NewRepository(config.Database)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer repo.Close()
+
+		log.Println("Load articles")
+		SyncArticles(opts.ArticlesDir, repo, opts.Sync)
+
+		err = ImportPublishDates(path, repo)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+	case "stats":
+		flags := flag.NewFlagSet("stats", flag.ExitOnError)
+		asJSON := flags.Bool("json", false, "print statistics as JSON")
+		config, _ := loadConfig(flags, os.Args[2:], 0)
+		opts := serverOptions(config)
+
+		repo, err := NewRepository(config.Database)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer repo.Close()
+
+		SyncArticles(opts.ArticlesDir, repo, opts.Sync)
+
+		articles, err := repo.ListArticles(ListOptions{})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		err = PrintStats(os.Stdout, articles, *asJSON)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+	case "db":
+		action := getCLIArg(2)
+		config, _ := loadConfig(flag.NewFlagSet("db", flag.ExitOnError), os.Args[3:], 0)
+
+		// status only reads, it must not create or adopt the database
+		dbConn := config.Database
+		if action == "status" {
+			dbConn = "file:" + dbConn + "?mode=ro"
+		}
+
+		repo, err := OpenRepository(dbConn)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		defer repo.Close()
+
+		switch action {
+		case "migrate":
+			applied, err := repo.Migrate()
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			if len(applied) == 0 {
+				fmt.Println("Database is up to date")
+			}
+			for _, migration := range applied {
+				fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+			}
+
+		case "status":
+			status, err := repo.MigrationStatus()
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			for _, entry := range status {
+				if entry.Applied && entry.AppliedAt.IsZero() {
+					fmt.Printf("applied  %04d_%s  (recorded on the next migrate)\n", entry.Version, entry.Name)
+				} else if entry.Applied {
+					fmt.Printf("applied  %04d_%s  %s\n", entry.Version, entry.Name, entry.AppliedAt.Local().Format(time.DateTime))
+				} else {
+					fmt.Printf("pending  %04d_%s\n", entry.Version, entry.Name)
+				}
+			}
+
+		default:
+			PrintHelp()
+			os.Exit(1)
+		}
 
 	default:
 		PrintHelp()
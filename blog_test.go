@@ -0,0 +1,286 @@
+package main
+
+import (
+	"os"
+	"time"
+	"slices"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+// Opens a migrated database in a temporary directory
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	repo, err := NewRepository(filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func createTestArticle(t *testing.T, repo *Repository, name string, source string) Article {
+	t.Helper()
+	article, err := ArticleFromMarkdown(name, source, DefaultMarkdownOptions)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	article.Id, err = repo.CreateArticle(article)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return article
+}
+
+// Serves the router of a server with the embedded default templates
+func newTestServer(t *testing.T, repo *Repository, opts ServerOptions) http.Handler {
+	t.Helper()
+	templates, err := LoadTemplates(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("load templates: %v", err)
+	}
+	return NewServer(repo, templates, opts).Router()
+}
+
+func TestPublishing(t *testing.T) {
+	repo := newTestRepository(t)
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+
+	createTestArticle(t, repo, "published", "---\ntitle: Published\ndate: 2024-03-05\n---\nText\n")
+	createTestArticle(t, repo, "undated", "# Undated\n")
+	createTestArticle(t, repo, "draft", "---\ntitle: Draft\ndraft: true\n---\nText\n")
+	createTestArticle(t, repo, "scheduled", "---\ntitle: Scheduled\ndate: " + tomorrow + "\n---\nText\n")
+
+	published, err := repo.ListPublishedArticles(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(published))
+	for _, article := range published {
+		names = append(names, article.Name)
+	}
+	if len(names) != 2 || names[0] != "undated" || names[1] != "published" {
+		t.Errorf("published articles %v, want [undated published]", names)
+	}
+
+	handler := newTestServer(t, repo, ServerOptions{PreviewToken: "secret"})
+
+	tests := []struct {
+		path string
+		status int
+		noindex bool
+	}{
+		{"/article/published", 200, false},
+		{"/article/undated", 200, false},
+		{"/article/draft", 404, false},
+		{"/article/scheduled", 404, false},
+		{"/article/scheduled?preview=wrong", 404, false},
+		{"/article/scheduled?preview=secret", 200, true},
+		{"/article/draft?preview=secret", 200, true},
+		{"/article/missing?preview=secret", 404, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+
+			if rec.Code != test.status {
+				t.Errorf("status %d, want %d", rec.Code, test.status)
+			}
+			if noindex := rec.Header().Get("X-Robots-Tag") == "noindex"; noindex != test.noindex {
+				t.Errorf("noindex %v, want %v", noindex, test.noindex)
+			}
+		})
+	}
+}
+
+func TestInitProjectTree(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"blog.toml": "title = \"Mine\"\n"})
+
+	// Twice, the second run must keep everything
+	for i := 0; i < 2; i++ {
+		if err := InitProjectTree(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"templates", "articles", "static"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() || info.Mode().Perm() & 0o700 != 0o700 {
+			t.Errorf("%s has mode %v, want a directory its owner can enter", name, info.Mode())
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "blog.toml"))
+	if err != nil || string(data) != "title = \"Mine\"\n" {
+		t.Errorf("existing blog.toml replaced by %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "templates", "article.html")); err != nil {
+		t.Errorf("template not created: %v", err)
+	}
+}
+
+func TestUpdateArticleDates(t *testing.T) {
+	original := "---\ntitle: Dates\ndescription: Old\n---\nText\n"
+	tests := []struct {
+		name string
+		source string
+		bumped bool
+	}{
+		{"same source", original, false},
+		{"description", "---\ntitle: Dates\ndescription: New\n---\nText\n", false},
+		{"content", "---\ntitle: Dates\ndescription: Old\n---\nOther text\n", true},
+		{"title", "---\ntitle: New dates\ndescription: Old\n---\nText\n", true},
+		{"draft", "---\ntitle: Dates\ndescription: Old\ndraft: true\n---\nText\n", true},
+		{"publish date", "---\ntitle: Dates\ndescription: Old\ndate: 2024-03-05\n---\nText\n", true},
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			article := createTestArticle(t, repo, "dates", original)
+			if err := repo.SetArticleDates("dates", created, updated); err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := ArticleFromMarkdown("dates", test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed.Id = article.Id
+			if err := repo.UpdateArticle(changed); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := repo.GetArticleByName("dates")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !stored.CreatedAt.Equal(created) {
+				t.Errorf("created at %v, want %v", stored.CreatedAt, created)
+			}
+			if bumped := !stored.UpdatedAt.Equal(updated); bumped != test.bumped {
+				t.Errorf("updated at %v, bumped %v, want %v", stored.UpdatedAt, bumped, test.bumped)
+			}
+		})
+	}
+}
+
+func TestImportPublishDates(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "imported", "# Imported\n")
+
+	path := filepath.Join(t.TempDir(), "publish_dates.json")
+	writeTestFiles(t, filepath.Dir(path), map[string]string{
+		"publish_dates.json": `{
+			"imported": {"CreatedAt": "2025-10-04T08:33:22-03:00", "UpdatedAt": "2025-10-05T08:33:22-03:00"},
+			"missing": {"CreatedAt": "2025-10-04T08:33:22-03:00", "UpdatedAt": "2025-10-04T08:33:22-03:00"}
+		}`,
+	})
+
+	if err := ImportPublishDates(path, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	article, err := repo.GetArticleByName("imported")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 10, 4, 11, 33, 22, 0, time.UTC); !article.CreatedAt.Equal(want) {
+		t.Errorf("created at %v, want %v", article.CreatedAt, want)
+	}
+	if want := time.Date(2025, 10, 5, 11, 33, 22, 0, time.UTC); !article.UpdatedAt.Equal(want) {
+		t.Errorf("updated at %v, want %v", article.UpdatedAt, want)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"Go", "go", " GO "}, []string{"go"}},
+		{[]string{"C++   Tips"}, []string{"c++ tips"}},
+		{[]string{"a/b", `c\d`}, []string{"a-b", "c-d"}},
+		{[]string{"", "  "}, []string{}},
+	}
+
+	for _, test := range tests {
+		if got := normalizeTags(test.tags); !slices.Equal(got, test.want) {
+			t.Errorf("normalizeTags(%q) = %q, want %q", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestTagPages(t *testing.T) {
+	repo := newTestRepository(t)
+	first := createTestArticle(t, repo, "first", "---\ntitle: First\ntags: [Go, C++ Tips]\n---\nText\n")
+	createTestArticle(t, repo, "second", "---\ntitle: Second\ntags: [go, a/b]\n---\nText\n")
+	createTestArticle(t, repo, "draft", "---\ntitle: Draft\ndraft: true\ntags: [secret]\n---\nText\n")
+
+	tags, err := repo.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TagCount{{Name: "a-b", Count: 1}, {Name: "c++ tips", Count: 1}, {Name: "go", Count: 2}}
+	if !slices.Equal(tags, want) {
+		t.Errorf("tags %+v, want %+v", tags, want)
+	}
+
+	handler := newTestServer(t, repo, ServerOptions{})
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	tests := []struct {
+		path string
+		status int
+	}{
+		{"/tag/go", 200},
+		{"/tag/GO", 200},
+		{"/tag/c++%20tips", 200},
+		{"/tag/a-b", 200},
+		{"/tag/secret", 404},
+		{"/tag/missing", 404},
+	}
+	for _, test := range tests {
+		if rec := get(test.path); rec.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.path, rec.Code, test.status)
+		}
+	}
+
+	body := get("/tags").Body.String()
+	if !strings.Contains(body, `href="/tag/c&#43;&#43;%20tips"`) || strings.Contains(body, "secret") {
+		t.Errorf("tags page\n%s", body)
+	}
+
+	// Tags without articles are dropped
+	changed, err := ArticleFromMarkdown("first", "---\ntitle: First\ntags: [go]\n---\nText\n", DefaultMarkdownOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed.Id = first.Id
+	if err := repo.UpdateArticle(changed); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get("/tag/c++%20tips"); rec.Code != 404 {
+		t.Errorf("removed tag status %d", rec.Code)
+	}
+	var count int
+	if err := repo.db.Get(&count, "SELECT count(*) FROM Tag WHERE Name = 'c++ tips'"); err != nil || count != 0 {
+		t.Errorf("%d rows of a tag without articles (%v)", count, err)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"log"
+	"os"
+	"fmt"
+	"bytes"
+	"errors"
+	"slices"
+	"time"
+	"strings"
+	"net/url"
+	"io/fs"
+	"path/filepath"
+)
+
+// Writes a static copy of the blog, pages use pretty URLs so
+// /article/<name> is stored as article/<name>/index.html.
+type SiteBuilder struct {
+	OutDir string
+	Written int
+	Unchanged int
+	Removed int
+	// Every file of the current build, written or unchanged
+	built map[string]bool
+	// Files listed in the manifest of the previous build
+	previous []string
+}
+
+// Writes data to path (relative to the output directory) unless the file
+// already has the same contents, so unchanged files keep their timestamps.
+func (b *SiteBuilder) WriteFile(path string, data []byte) error {
+	p := filepath.Join(b.OutDir, filepath.FromSlash(path))
+	if b.built == nil {
+		b.built = make(map[string]bool)
+	}
+	b.built[path] = true
+
+	if current, err := os.ReadFile(p); err == nil && bytes.Equal(current, data) {
+		b.Unchanged += 1
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil { return err }
+
+	err = os.WriteFile(p, data, 0o644)
+	if err != nil { return err }
+
+	log.Println("Write", p)
+	b.Written += 1
+	return nil
+}
+
+func (b *SiteBuilder) WritePage(path string, render func(buf *bytes.Buffer) error) error {
+	buf := bytes.Buffer{}
+	err := render(&buf)
+	if err != nil { return err }
+	return b.WriteFile(path, buf.Bytes())
+}
+
+// Writes every feed format into dir, urlDir is the same directory as seen in
+// URLs.
+func (b *SiteBuilder) WriteFeeds(dir string, urlDir string, title string, articles []Article, opts FeedOptions) error {
+	for _, format := range FeedFormats {
+		name := "feed." + string(format)
+		feed := NewFeed(title, "/" + urlDir, "/" + urlDir + name, articles, opts)
+
+		data, err := feed.Render(format)
+		if err != nil { return err }
+
+		err = b.WriteFile(dir + name, data)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// Names used as directories must not escape the output directory
+func isSafePathSegment(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (b *SiteBuilder) CopyDir(src string, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil { return err }
+
+		data, err := os.ReadFile(path)
+		if err != nil { return err }
+
+		return b.WriteFile(dest + "/" + filepath.ToSlash(rel), data)
+	})
+}
+
+// Walks the index page by page, continuing after the last article of the
+// previous page
+func (b *SiteBuilder) WriteIndexPages(repo *Repository, templates *Templates, opts ServerOptions) error {
+	listOpts := pageListOptions(opts.PageSize)
+
+	for page := 1; ; page++ {
+		articles, err := repo.ListPublishedArticles(listOpts)
+		if err != nil { return err }
+
+		articles, hasOlder := splitPage(articles, opts.PageSize)
+
+		path := "index.html"
+		if page > 1 {
+			path = strings.TrimPrefix(pageURL(page), "/") + "/index.html"
+		}
+		err = b.WritePage(path, func(buf *bytes.Buffer) error {
+			return RenderIndexPage(buf, templates.Index, opts.Site, articles, NewPagination(page, hasOlder))
+		})
+		if err != nil { return err }
+
+		if !hasOlder {
+			return nil
+		}
+		cursor := articles[len(articles) - 1].Cursor()
+		listOpts.After = &cursor
+	}
+}
+
+// Writes /archive and a page for every year and month with articles, articles
+// must be sorted newest first
+func (b *SiteBuilder) WriteArchivePages(articles []Article, templates *Templates, site Site) error {
+	err := b.WritePage("archive/index.html", func(buf *bytes.Buffer) error {
+		return RenderArchivePage(buf, templates.Archive, site, archiveTitle(0, 0), articles)
+	})
+	if err != nil { return err }
+
+	for _, year := range GroupArchive(articles) {
+		// Month 0 is the page of the whole year
+		months := []time.Month{0}
+		for _, month := range year.Months {
+			months = append(months, month.Month)
+		}
+
+		for _, month := range months {
+			since, until := ArchiveRange(year.Year, month)
+			pageArticles := make([]Article, 0, 8)
+			for _, article := range articles {
+				if published := article.PublishDate().UTC(); !published.Before(since) && published.Before(until) {
+					pageArticles = append(pageArticles, article)
+				}
+			}
+
+			path := strings.TrimPrefix(archiveURL(year.Year, month), "/") + "/index.html"
+			err = b.WritePage(path, func(buf *bytes.Buffer) error {
+				return RenderArchivePage(buf, templates.Archive, site, archiveTitle(year.Year, month), pageArticles)
+			})
+			if err != nil { return err }
+		}
+	}
+
+	return nil
+}
+
+// Lists every file a build produced, one path relative to the output
+// directory per line. The next build only removes files listed in it, so
+// files the blog did not create are never touched.
+const buildManifestName = ".blog-build"
+
+// Reads the manifest of the previous build. Without one the output directory
+// must be missing or empty, unless force is set.
+func (b *SiteBuilder) LoadManifest(force bool) error {
+	data, err := os.ReadFile(filepath.Join(b.OutDir, buildManifestName))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				b.previous = append(b.previous, line)
+			}
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) { return err }
+
+	entries, err := os.ReadDir(b.OutDir)
+	if errors.Is(err, fs.ErrNotExist) { return nil }
+	if err != nil { return err }
+
+	if len(entries) > 0 && !force {
+		return fmt.Errorf("output directory %q is not empty and has no %s from an earlier build, use --force to build into it anyway", b.OutDir, buildManifestName)
+	}
+	return nil
+}
+
+// Deletes the files of the previous build that the current one did not
+// write, e.g. pages of removed articles, and directories left empty, then
+// records the files of the current build in the manifest.
+func (b *SiteBuilder) RemoveStale() error {
+	outDir := filepath.Clean(b.OutDir)
+
+	for _, path := range b.previous {
+		if b.built[path] || !filepath.IsLocal(filepath.FromSlash(path)) {
+			continue
+		}
+
+		p := filepath.Join(outDir, filepath.FromSlash(path))
+		err := os.Remove(p)
+		if errors.Is(err, fs.ErrNotExist) { continue }
+		if err != nil { return err }
+		log.Println("Remove", p)
+		b.Removed += 1
+
+		// Removing a directory fails once it is not empty
+		for dir := filepath.Dir(p); dir != outDir; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(b.built))
+	for path := range b.built {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	err := os.MkdirAll(outDir, 0o755)
+	if err != nil { return err }
+
+	return os.WriteFile(filepath.Join(outDir, buildManifestName), []byte(strings.Join(paths, "\n") + "\n"), 0o644)
+}
+
+// Stale files are removed from the output directory, so it must not be one
+// that holds the sources of the blog
+func checkOutDir(outDir string, opts ServerOptions) error {
+	out, err := filepath.Abs(outDir)
+	if err != nil { return err }
+
+	for _, dir := range []string{opts.ArticlesDir, opts.TemplatesDir, opts.StaticDir} {
+		src, err := filepath.Abs(dir)
+		if err != nil { return err }
+		if rel, err := filepath.Rel(out, src); err == nil && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator)) {
+			return fmt.Errorf("output directory %q contains %q", outDir, dir)
+		}
+	}
+	return nil
+}
+
+func BuildSite(outDir string, force bool, repo *Repository, templates *Templates, opts ServerOptions) error {
+	b := &SiteBuilder{OutDir: outDir}
+	site := opts.Site
+
+	// Feeds, the sitemap and robots.txt need absolute URLs and a static copy
+	// has no request to take the host from
+	base, err := url.Parse(opts.Feed.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return fmt.Errorf("build needs an absolute base URL, set base_url in the config, BLOG_BASE_URL or --base-url (got %q)", opts.Feed.BaseURL)
+	}
+
+	err = checkOutDir(outDir, opts)
+	if err != nil { return err }
+
+	err = b.LoadManifest(force)
+	if err != nil { return err }
+
+	articles, err := repo.ListPublishedArticles(ListOptions{})
+	if err != nil { return err }
+
+	tags, err := repo.ListTags()
+	if err != nil { return err }
+
+	err = b.WriteIndexPages(repo, templates, opts)
+	if err != nil { return err }
+
+	err = b.WriteArchivePages(articles, templates, opts.Site)
+	if err != nil { return err }
+
+	for _, article := range articles {
+		if !isSafePathSegment(article.Name) {
+			log.Println("Skip article with invalid name", article.Name)
+			continue
+		}
+
+		err = b.WritePage("article/" + article.Name + "/index.html", func(buf *bytes.Buffer) error {
+			return RenderArticle(buf, templates.Article, site, article)
+		})
+		if err != nil { return err }
+	}
+
+	err = b.WritePage("tags/index.html", func(buf *bytes.Buffer) error {
+		return RenderTagsPage(buf, templates.Tags, site, tags)
+	})
+	if err != nil { return err }
+
+	for _, tag := range tags {
+		if !isSafePathSegment(tag.Name) {
+			log.Println("Skip tag with invalid name", tag.Name)
+			continue
+		}
+
+		tagArticles, err := repo.ListArticlesByTag(tag.Name)
+		if err != nil { return err }
+
+		dir := "tag/" + tag.Name + "/"
+		err = b.WritePage(dir + "index.html", func(buf *bytes.Buffer) error {
+			return RenderTagPage(buf, templates.Tag, site, tag.Name, tagArticles)
+		})
+		if err != nil { return err }
+
+		urlDir := strings.TrimPrefix(tagURL(tag.Name), "/") + "/"
+		err = b.WriteFeeds(dir, urlDir, opts.Site.Title + ": " + tag.Name, tagArticles, opts.Feed)
+		if err != nil { return err }
+	}
+
+	err = b.WriteFeeds("", "", opts.Site.Title, articles, opts.Feed)
+	if err != nil { return err }
+
+	sitemaps, err := BuildSitemaps(opts.Feed.BaseURL, articles, tags, opts.Sitemap)
+	if err != nil { return err }
+
+	for name, data := range sitemaps {
+		err = b.WriteFile(name, data)
+		if err != nil { return err }
+	}
+
+	err = b.WritePage("robots.txt", func(buf *bytes.Buffer) error {
+		return RenderRobots(buf, templates.Robots, opts.Feed.BaseURL)
+	})
+	if err != nil { return err }
+
+	err = b.CopyDir(opts.StaticDir, "static")
+	if err != nil { return err }
+
+	if templates.Assets != nil {
+		err = b.WriteAssets(templates.Assets, "static")
+		if err != nil { return err }
+	}
+
+	err = b.RemoveStale()
+	if err != nil { return err }
+
+	log.Printf("Wrote %d files, %d unchanged, %d removed", b.Written, b.Unchanged, b.Removed)
+	return nil
+}
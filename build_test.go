@@ -0,0 +1,266 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"path/filepath"
+)
+
+// Creates files relative to dir, a name ending in a slash creates a directory
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Lists files and directories below dir as slash separated relative paths,
+// directories end with a slash
+func listTestFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	paths := make([]string, 0, 16)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil { return err }
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			rel += "/"
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestRemoveStale(t *testing.T) {
+	tests := []struct {
+		name string
+		// Contents of the output directory before the build
+		existing map[string]string
+		force bool
+		built []string
+		wantErr bool
+		// Remaining files, without the manifest
+		want []string
+		removed int
+	}{
+		{
+			name: "missing directory",
+			built: []string{"index.html", "article/a/index.html"},
+			want: []string{"article/", "article/a/", "article/a/index.html", "index.html"},
+		},
+		{
+			name: "empty directory",
+			existing: map[string]string{"./": ""},
+			built: []string{"index.html"},
+			want: []string{"index.html"},
+		},
+		{
+			name: "foreign files without manifest",
+			existing: map[string]string{"notes.txt": "mine"},
+			built: []string{"index.html"},
+			wantErr: true,
+		},
+		{
+			name: "foreign files with force are kept",
+			existing: map[string]string{"notes.txt": "mine", "article/old/index.html": "old"},
+			force: true,
+			built: []string{"index.html"},
+			want: []string{"article/", "article/old/", "article/old/index.html", "index.html", "notes.txt"},
+		},
+		{
+			name: "files of the previous build are removed",
+			existing: map[string]string{
+				buildManifestName: "index.html\narticle/a/index.html\narticle/b/index.html\ntag/two words/index.html\n",
+				"index.html": "old",
+				"article/a/index.html": "old",
+				"article/b/index.html": "old",
+				"tag/two words/index.html": "old",
+			},
+			built: []string{"index.html", "article/a/index.html"},
+			want: []string{"article/", "article/a/", "article/a/index.html", "index.html"},
+			removed: 2,
+		},
+		{
+			name: "unlisted files are kept",
+			existing: map[string]string{
+				buildManifestName: "article/b/index.html\n",
+				"article/b/index.html": "old",
+				"article/b/photo.jpg": "mine",
+				"CNAME": "example.com",
+			},
+			built: []string{"index.html"},
+			want: []string{"CNAME", "article/", "article/b/", "article/b/photo.jpg", "index.html"},
+			removed: 1,
+		},
+		{
+			name: "paths outside the directory are ignored",
+			existing: map[string]string{
+				buildManifestName: "../outside.txt\n/etc/hostname\n",
+			},
+			built: []string{"index.html"},
+			want: []string{"index.html"},
+		},
+		{
+			name: "listed files that are gone",
+			existing: map[string]string{buildManifestName: "feed.atom\n"},
+			built: []string{"index.html"},
+			want: []string{"index.html"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestFiles(t, root, map[string]string{"outside.txt": "keep"})
+			outDir := filepath.Join(root, "out")
+			if test.existing != nil {
+				writeTestFiles(t, outDir, test.existing)
+			}
+
+			b := &SiteBuilder{OutDir: outDir}
+			err := b.LoadManifest(test.force)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, path := range test.built {
+				if err := b.WriteFile(path, []byte("new")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := b.RemoveStale(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := slices.DeleteFunc(listTestFiles(t, outDir), func(path string) bool {
+				return path == buildManifestName
+			})
+			if !slices.Equal(got, test.want) {
+				t.Errorf("files %q, want %q", got, test.want)
+			}
+			if b.Removed != test.removed {
+				t.Errorf("removed %d, want %d", b.Removed, test.removed)
+			}
+			if _, err := os.Stat(filepath.Join(root, "outside.txt")); err != nil {
+				t.Errorf("file outside the output directory: %v", err)
+			}
+
+			manifest, err := os.ReadFile(filepath.Join(outDir, buildManifestName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			listed := strings.Split(strings.TrimSuffix(string(manifest), "\n"), "\n")
+			built := slices.Sorted(slices.Values(test.built))
+			if !slices.Equal(listed, built) {
+				t.Errorf("manifest %q, want %q", listed, built)
+			}
+		})
+	}
+}
+
+func TestBuildSite(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "post", "---\ntitle: Post\ndate: 2024-03-05\ntags: [go]\n---\nText\n")
+	other := createTestArticle(t, repo, "other", "---\ntitle: Other\ndate: 2024-04-01\ntags: [rust]\n---\nText\n")
+	createTestArticle(t, repo, "draft", "---\ntitle: Draft\ndraft: true\n---\nText\n")
+
+	root := t.TempDir()
+	opts := ServerOptions{
+		Feed: FeedOptions{BaseURL: "https://example.com"},
+		ArticlesDir: filepath.Join(root, "articles"),
+		TemplatesDir: filepath.Join(root, "templates"),
+		StaticDir: filepath.Join(root, "static"),
+	}
+	writeTestFiles(t, root, map[string]string{"articles/": "", "templates/": "", "static/app.css": "body {}\n"})
+
+	assets, err := LoadAssets(opts.StaticDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadTemplates(opts.TemplatesDir, assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprinted := "static/" + assets.assets["app.css"].Fingerprinted
+
+	outDir := filepath.Join(root, "out")
+	if err := BuildSite(outDir, false, repo, templates, opts); err != nil {
+		t.Fatal(err)
+	}
+	files := listTestFiles(t, outDir)
+	for _, want := range []string{
+		"index.html", "article/post/index.html", "article/other/index.html", "archive/index.html",
+		"2024/index.html", "2024/03/index.html", "tags/index.html", "tag/go/index.html", "tag/rust/feed.atom",
+		"feed.atom", "feed.rss", "feed.json", "sitemap.xml", "robots.txt", "static/app.css", fingerprinted,
+		buildManifestName,
+	} {
+		if !slices.Contains(files, want) {
+			t.Errorf("%s not built", want)
+		}
+	}
+	if slices.Contains(files, "article/draft/index.html") {
+		t.Error("draft built")
+	}
+
+	// Archiving an article removes its pages on the next build
+	if err := repo.ArchiveArticle(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildSite(outDir, false, repo, templates, opts); err != nil {
+		t.Fatal(err)
+	}
+	files = listTestFiles(t, outDir)
+	for _, gone := range []string{"article/other/", "tag/rust/", "2024/04/"} {
+		if slices.Contains(files, gone) {
+			t.Errorf("%s still there after archiving", gone)
+		}
+	}
+	if !slices.Contains(files, "article/post/index.html") {
+		t.Error("article/post/index.html removed")
+	}
+
+	errorTests := []struct {
+		name string
+		outDir string
+		baseURL string
+	}{
+		{"relative base URL", filepath.Join(root, "relative"), "/blog"},
+		{"output contains the articles", root, "https://example.com"},
+		{"output inside the static files", filepath.Join(opts.StaticDir, "out"), "https://example.com"},
+	}
+	for _, test := range errorTests {
+		opts := opts
+		opts.Feed.BaseURL = test.baseURL
+		if err := BuildSite(test.outDir, true, repo, templates, opts); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+	"bytes"
+	"strings"
+	"net/http"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Cache-Control header values by kind of route, an empty value sends no header
+type CacheOptions struct {
+	// Index, archive, tag and search pages
+	Pages string
+	Articles string
+	// Feeds, sitemaps and robots.txt
+	Feeds string
+	Static string
+}
+
+// Pages are always revalidated, which is cheap with validators
+var DefaultCacheOptions = CacheOptions{
+	Pages: "no-cache",
+	Articles: "no-cache",
+	Feeds: "public, max-age=900",
+	Static: "public, max-age=3600",
+}
+
+func cacheControl(value string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if value != "" {
+				w.Header().Set("Cache-Control", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Strong ETag over parts, callers include the template version so a changed
+// template invalidates pages whose content did not change
+func contentETag(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Etag of a page listing articles
+func articleListETag(version string, articles []Article, extra ...string) string {
+	parts := make([]string, 0, len(articles) * 2 + len(extra) + 1)
+	parts = append(parts, version)
+	parts = append(parts, extra...)
+	for _, article := range articles {
+		parts = append(parts, article.Name, article.Hash)
+	}
+	return contentETag(parts...)
+}
+
+// Last-Modified of a page showing articles: the latest edit or publication of
+// one of them, or a later change that could have altered the page without
+// touching them, e.g. archiving another article or reloading templates
+func lastUpdated(articles []Article, changes ...time.Time) time.Time {
+	var updated time.Time
+	for _, article := range articles {
+		changes = append(changes, article.UpdatedAt, article.PublishDate())
+	}
+	for _, change := range changes {
+		if change.After(updated) {
+			updated = change
+		}
+	}
+	return updated
+}
+
+// ETag of a compressed copy of a page, which must differ from the ETag of the
+// uncompressed page
+func encodedETag(etag string, encoding string) string {
+	if etag == "" {
+		return ""
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// If-None-Match takes precedence, If-Modified-Since is only checked when it
+// is absent
+func isNotModified(r *http.Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag)
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have no sub second precision
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// Answers with 304 when the client copy is current, the page is only rendered
+// otherwise
+func servePage(w http.ResponseWriter, r *http.Request, etag string, modified time.Time, render func(w io.Writer) error) {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	buf := bytes.Buffer{}
+	err := render(&buf)
+	if err != nil {
+		log.Println("Failed to execute template:", err.Error())
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		httpError(w, 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
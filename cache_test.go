@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"time"
+	"errors"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestIsNotModified(t *testing.T) {
+	etag := `"abc"`
+	modified := time.Date(2024, 3, 5, 10, 0, 0, 500_000_000, time.UTC)
+	httpDate := func(t time.Time) string { return t.Format(http.TimeFormat) }
+
+	tests := []struct {
+		name string
+		ifNoneMatch string
+		ifModifiedSince string
+		modified time.Time
+		want bool
+	}{
+		{"no validators", "", "", modified, false},
+		{"matching etag", `"abc"`, "", modified, true},
+		{"weak etag", `W/"abc"`, "", modified, true},
+		{"etag in list", `"x", "abc"`, "", modified, true},
+		{"any etag", "*", "", modified, true},
+		{"other etag", `"x"`, "", modified, false},
+		{"etag wins over date", `"x"`, httpDate(modified.Add(time.Hour)), modified, false},
+		{"same second", "", httpDate(modified), modified, true},
+		{"later date", "", httpDate(modified.Add(time.Hour)), modified, true},
+		{"earlier date", "", httpDate(modified.Add(-time.Second)), modified, false},
+		{"invalid date", "", "yesterday", modified, false},
+		{"unknown modification", "", httpDate(modified), time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			if test.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", test.ifModifiedSince)
+			}
+			if got := isNotModified(r, etag, test.modified); got != test.want {
+				t.Errorf("isNotModified = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestServePage(t *testing.T) {
+	modified := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		ifNoneMatch string
+		err error
+		status int
+		rendered bool
+		validators bool
+	}{
+		{"render", "", nil, 200, true, true},
+		{"not modified", `"page"`, nil, 304, false, true},
+		{"template error", "", errors.New("broken"), 500, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+				servePage(w, r, `"page"`, modified, func(w io.Writer) error {
+					rendered = true
+					io.WriteString(w, "<p>page</p>")
+					return test.err
+				})
+			})
+
+			rec := requestPage(handler, "/", map[string]string{"If-None-Match": test.ifNoneMatch})
+			if rec.Code != test.status || rendered != test.rendered {
+				t.Errorf("status %d, rendered %v, want %d and %v", rec.Code, rendered, test.status, test.rendered)
+			}
+			validators := rec.Header().Get("ETag") == `"page"` && rec.Header().Get("Last-Modified") == "Tue, 05 Mar 2024 10:00:00 GMT"
+			if validators != test.validators {
+				t.Errorf("ETag %q, Last-Modified %q", rec.Header().Get("ETag"), rec.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestPageValidators(t *testing.T) {
+	repo := newTestRepository(t)
+	article := createTestArticle(t, repo, "post", "---\ntitle: Post\ndate: 2024-03-05\n---\nText\n")
+	handler := newTestServer(t, repo, ServerOptions{Cache: DefaultCacheOptions})
+
+	type validators struct {
+		etag string
+		modified string
+	}
+	fetch := func(path string) validators {
+		rec := requestPage(handler, path, nil)
+		if rec.Code != 200 {
+			t.Fatalf("%s: status %d", path, rec.Code)
+		}
+		return validators{rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")}
+	}
+
+	paths := []string{"/", "/article/post", "/archive"}
+	before := make(map[string]validators)
+	for _, path := range paths {
+		before[path] = fetch(path)
+
+		for _, header := range []map[string]string{{"If-None-Match": before[path].etag}, {"If-Modified-Since": before[path].modified}} {
+			if rec := requestPage(handler, path, header); rec.Code != 304 {
+				t.Errorf("%s with %v: status %d, want 304", path, header, rec.Code)
+			}
+		}
+	}
+
+	if rec := requestPage(handler, "/article/post", nil); rec.Header().Get("Cache-Control") != DefaultCacheOptions.Articles {
+		t.Errorf("article Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+
+	// Editing the article changes the validators of every page showing it
+	time.Sleep(time.Second)
+	changed, err := ArticleFromMarkdown("post", "---\ntitle: Post\ndate: 2024-03-05\n---\nOther text\n", DefaultMarkdownOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed.Id = article.Id
+	if err := repo.UpdateArticle(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		after := fetch(path)
+		if after.etag == before[path].etag || after.modified == before[path].modified {
+			t.Errorf("%s: validators %v unchanged by an edit", path, after)
+		}
+		if rec := requestPage(handler, path, map[string]string{"If-None-Match": before[path].etag}); rec.Code != 200 {
+			t.Errorf("%s with the old ETag: status %d, want 200", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"io/fs"
+)
+
+const DefaultConfigPath = "blog.toml"
+
+// Site wide settings, available to every template as .Site
+type Site struct {
+	Title string
+	Description string
+	// Absolute URL the blog is served from, without trailing slash. Empty
+	// uses the host of each request.
+	BaseURL string
+	// Default author of articles that do not name one
+	Author string
+}
+
+// Settings read from blog.toml, environment variables override the file and
+// command line flags override both
+type Config struct {
+	Site Site
+	// Listen address of serve
+	Address string
+	Database string
+	ArticlesDir string
+	TemplatesDir string
+	StaticDir string
+	PageSize int
+	PageCacheSize int
+	PreviewToken string
+	RemovalPolicy string
+	Markdown MarkdownOptions
+	// 'full' or 'excerpt'
+	FeedContent string
+	FeedLimit int
+	Sitemap SitemapOptions
+	Cache CacheOptions
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Site: Site{
+			Title: "The Blog",
+		},
+		Address: ":8080",
+		Database: "blog.db",
+		ArticlesDir: "articles",
+		TemplatesDir: "templates",
+		StaticDir: "static",
+		PageSize: 10,
+		PageCacheSize: 512,
+		RemovalPolicy: string(RemovalArchive),
+		Markdown: DefaultMarkdownOptions,
+		FeedContent: "full",
+		FeedLimit: 20,
+		Sitemap: SitemapOptions{
+			IndexPriority: 1.0,
+			ArticlePriority: 0.8,
+			ArchivePriority: 0.3,
+			TagPriority: 0.5,
+		},
+		Cache: DefaultCacheOptions,
+	}
+}
+
+// A setting is read from key in blog.toml (table and key joined with a dot),
+// from env and from the flag named like key with dashes
+type configSetting struct {
+	key string
+	env string
+	usage string
+	// *string, *int, *bool or *float64
+	target any
+}
+
+func (config *Config) settings() []configSetting {
+	return []configSetting{
+		{"title", "BLOG_TITLE", "site title", &config.Site.Title},
+		{"description", "BLOG_DESCRIPTION", "site description shown on the index", &config.Site.Description},
+		{"base_url", "BLOG_BASE_URL", "absolute URL of the blog, defaults to the host of each request", &config.Site.BaseURL},
+		{"author", "BLOG_AUTHOR", "default author of articles", &config.Site.Author},
+		{"address", "BLOG_ADDRESS", "listen address of serve", &config.Address},
+		{"database", "BLOG_DATABASE", "path of the database", &config.Database},
+		{"articles_dir", "BLOG_ARTICLES_DIR", "directory of the markdown articles", &config.ArticlesDir},
+		{"templates_dir", "BLOG_TEMPLATES_DIR", "directory of the templates", &config.TemplatesDir},
+		{"static_dir", "BLOG_STATIC_DIR", "directory of the static files", &config.StaticDir},
+		{"page_size", "BLOG_PAGE_SIZE", "articles per index page, 0 puts all on one page", &config.PageSize},
+		{"page_cache_size", "BLOG_PAGE_CACHE_SIZE", "rendered pages kept in memory, 0 disables the page cache", &config.PageCacheSize},
+		{"preview_token", "BLOG_PREVIEW_TOKEN", "secret that allows viewing drafts and scheduled articles", &config.PreviewToken},
+		{"removal", "BLOG_REMOVAL_POLICY", "keep, archive or delete articles whose source is gone", &config.RemovalPolicy},
+		{"markdown.tables", "", "enable tables", &config.Markdown.Tables},
+		{"markdown.strikethrough", "", "enable ~~strikethrough~~", &config.Markdown.Strikethrough},
+		{"markdown.definition_lists", "", "enable definition lists", &config.Markdown.DefinitionLists},
+		{"markdown.footnotes", "", "enable footnotes", &config.Markdown.Footnotes},
+		{"markdown.math", "", "render $TeX$ math", &config.Markdown.Math},
+		{"markdown.admonitions", "", "render [!NOTE] blockquotes as admonitions", &config.Markdown.Admonitions},
+		{"markdown.highlight", "", "highlight fenced code blocks", &config.Markdown.Highlight},
+		{"feed.content", "BLOG_FEED_CONTENT", "'full' or 'excerpt' articles in feeds", &config.FeedContent},
+		{"feed.limit", "BLOG_FEED_LIMIT", "entries per feed, 0 means no limit", &config.FeedLimit},
+		{"sitemap.index_priority", "", "sitemap priority of the index", &config.Sitemap.IndexPriority},
+		{"sitemap.article_priority", "", "sitemap priority of articles", &config.Sitemap.ArticlePriority},
+		{"sitemap.archive_priority", "", "sitemap priority of the archive", &config.Sitemap.ArchivePriority},
+		{"sitemap.tag_priority", "", "sitemap priority of tag pages", &config.Sitemap.TagPriority},
+		{"cache.pages", "BLOG_CACHE_PAGES", "Cache-Control of index, archive, tag and search pages", &config.Cache.Pages},
+		{"cache.articles", "BLOG_CACHE_ARTICLES", "Cache-Control of articles", &config.Cache.Articles},
+		{"cache.feeds", "BLOG_CACHE_FEEDS", "Cache-Control of feeds, sitemaps and robots.txt", &config.Cache.Feeds},
+		{"cache.static", "BLOG_CACHE_STATIC", "Cache-Control of static files", &config.Cache.Static},
+	}
+}
+
+func (setting configSetting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(setting.key)
+}
+
+// Assigns a value from blog.toml, integers are accepted for float settings
+func (setting configSetting) set(value any) error {
+	ok := false
+	switch target := setting.target.(type) {
+	case *string:
+		var v string
+		v, ok = value.(string)
+		*target = v
+	case *int:
+		var v int64
+		v, ok = value.(int64)
+		*target = int(v)
+	case *bool:
+		var v bool
+		v, ok = value.(bool)
+		*target = v
+	case *float64:
+		switch v := value.(type) {
+		case float64:
+			*target, ok = v, true
+		case int64:
+			*target, ok = float64(v), true
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("invalid value %v for %s", value, setting.key)
+	}
+	return nil
+}
+
+// Assigns a value given as text, by environment variables and flags
+func (setting configSetting) parse(s string) error {
+	var err error
+	switch target := setting.target.(type) {
+	case *string:
+		*target = s
+	case *int:
+		*target, err = strconv.Atoi(s)
+	case *bool:
+		*target, err = strconv.ParseBool(s)
+	case *float64:
+		*target, err = strconv.ParseFloat(s, 64)
+	}
+	return err
+}
+
+// Reads settings from a blog.toml file, a missing file leaves config as is
+func (config *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fields, err := parseTOMLFrontMatter(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	settings := config.settings()
+	var apply func(fields map[string]any, prefix string) error
+	apply = func(fields map[string]any, prefix string) error {
+		for key, value := range fields {
+			if table, ok := value.(map[string]any); ok {
+				err := apply(table, prefix + key + ".")
+				if err != nil { return err }
+				continue
+			}
+
+			i := slices.IndexFunc(settings, func(setting configSetting) bool {
+				return setting.key == prefix + key
+			})
+			if i < 0 {
+				return fmt.Errorf("%s: unknown setting %s", path, prefix + key)
+			}
+
+			err := settings[i].set(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		return nil
+	}
+
+	return apply(fields, "")
+}
+
+// Overrides settings with the environment variables that are set
+func (config *Config) LoadEnv() error {
+	for _, setting := range config.settings() {
+		if setting.env == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(setting.env)
+		if !ok {
+			continue
+		}
+
+		err := setting.parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", setting.env, err)
+		}
+	}
+	return nil
+}
+
+// Adds a flag for every setting, defaulting to its current value
+func (config *Config) RegisterFlags(flags *flag.FlagSet) {
+	// Only read by configPath, registered so it is not rejected
+	flags.String("config", DefaultConfigPath, "path of the configuration file")
+
+	for _, setting := range config.settings() {
+		name := setting.flagName()
+		switch target := setting.target.(type) {
+		case *string:
+			flags.StringVar(target, name, *target, setting.usage)
+		case *int:
+			flags.IntVar(target, name, *target, setting.usage)
+		case *bool:
+			flags.BoolVar(target, name, *target, setting.usage)
+		case *float64:
+			flags.Float64Var(target, name, *target, setting.usage)
+		}
+	}
+}
+
+// The configuration file is needed before flags are parsed, so --config is
+// looked up by hand
+func configPath(args []string) string {
+	path := DefaultConfigPath
+	if env := os.Getenv("BLOG_CONFIG"); env != "" {
+		path = env
+	}
+
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i + 1 < len(args) {
+			path = args[i + 1]
+		}
+	}
+
+	return path
+}
+
+// Defaults, then blog.toml, then environment variables
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	err := config.LoadFile(path)
+	if err != nil { return config, err }
+
+	err = config.LoadEnv()
+	return config, err
+}
+
+func (config Config) SyncOptions() (SyncOptions, error) {
+	removal, err := ParseRemovalPolicy(config.RemovalPolicy)
+	return SyncOptions{Removal: removal, Markdown: config.Markdown}, err
+}
+
+func (config Config) ServerOptions() (ServerOptions, error) {
+	sync, err := config.SyncOptions()
+	if err != nil { return ServerOptions{}, err }
+
+	switch config.FeedContent {
+	case "full", "excerpt":
+	default:
+		return ServerOptions{}, fmt.Errorf("unknown feed content %q, expected full or excerpt", config.FeedContent)
+	}
+
+	site := config.Site
+	site.BaseURL = strings.TrimSuffix(site.BaseURL, "/")
+
+	return ServerOptions{
+		Site: site,
+		PreviewToken: config.PreviewToken,
+		Sync: sync,
+		Feed: FeedOptions{
+			BaseURL: site.BaseURL,
+			FullContent: config.FeedContent == "full",
+			Limit: config.FeedLimit,
+			Author: site.Author,
+		},
+		PageSize: config.PageSize,
+		Sitemap: config.Sitemap,
+		Cache: config.Cache,
+		PageCacheSize: config.PageCacheSize,
+		Timeouts: ServerTimeouts{
+			Read: 10 * time.Second,
+			Write: 30 * time.Second,
+			Idle: 2 * time.Minute,
+			Shutdown: 15 * time.Second,
+		},
+		ArticlesDir: config.ArticlesDir,
+		TemplatesDir: config.TemplatesDir,
+		StaticDir: config.StaticDir,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"path/filepath"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"blog.toml": `
+title = "From file"
+author = "Ann"
+page_size = 5
+base_url = "https://example.com/"
+
+[markdown]
+math = false
+
+[sitemap]
+article_priority = 1
+`})
+	t.Setenv("BLOG_AUTHOR", "Bob")
+	t.Setenv("BLOG_PAGE_SIZE", "7")
+
+	config, err := LoadConfig(filepath.Join(dir, "blog.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	config.RegisterFlags(flags)
+	if err := flags.Parse([]string{"--config", "other.toml", "--page-size=9", "--markdown-tables=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got any
+		want any
+	}{
+		{"default", config.Address, ":8080"},
+		{"file", config.Site.Title, "From file"},
+		{"environment over file", config.Site.Author, "Bob"},
+		{"flag over environment", config.PageSize, 9},
+		{"table in file", config.Markdown.Math, false},
+		{"flag of table", config.Markdown.Tables, false},
+		{"integer for float", config.Sitemap.ArticlePriority, 1.0},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	opts, err := config.ServerOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Site.BaseURL != "https://example.com" || opts.Feed.BaseURL != "https://example.com" || opts.Feed.Author != "Bob" {
+		t.Errorf("server options %+v", opts)
+	}
+
+	missing, err := LoadConfig(filepath.Join(dir, "missing.toml"))
+	if err != nil || missing.Site.Title != DefaultConfig().Site.Title {
+		t.Errorf("missing file gave %+v (%v)", missing.Site, err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env map[string]string
+		err string
+	}{
+		{"unknown setting", "colour = \"red\"\n", nil, "unknown setting colour"},
+		{"unknown table setting", "[markdown]\nmermaid = true\n", nil, "unknown setting markdown.mermaid"},
+		{"wrong type", "page_size = \"ten\"\n", nil, "invalid value ten for page_size"},
+		{"invalid environment", "", map[string]string{"BLOG_PAGE_SIZE": "ten"}, "invalid BLOG_PAGE_SIZE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"blog.toml": test.file})
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := LoadConfig(filepath.Join(dir, "blog.toml"))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+
+	config := DefaultConfig()
+	config.FeedContent = "summary"
+	if _, err := config.ServerOptions(); err == nil {
+		t.Error("expected an error for an unknown feed content")
+	}
+	config = DefaultConfig()
+	config.RemovalPolicy = "shred"
+	if _, err := config.ServerOptions(); err == nil {
+		t.Error("expected an error for an unknown removal policy")
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		env string
+		args []string
+		want string
+	}{
+		{"", nil, DefaultConfigPath},
+		{"env.toml", nil, "env.toml"},
+		{"env.toml", []string{"--config", "a.toml"}, "a.toml"},
+		{"", []string{"-config=b.toml", "out"}, "b.toml"},
+		{"", []string{"--title", "config", "--", "--config", "c.toml"}, DefaultConfigPath},
+	}
+
+	for _, test := range tests {
+		t.Setenv("BLOG_CONFIG", test.env)
+		if got := configPath(test.args); got != test.want {
+			t.Errorf("configPath(%q) with BLOG_CONFIG=%q = %s, want %s", test.args, test.env, got, test.want)
+		}
+	}
+}
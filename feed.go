@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"cmp"
+	"time"
+	"regexp"
+	"strings"
+	"net/url"
+	"encoding/xml"
+	"encoding/json"
+	gohtml "html"
+)
+
+type FeedFormat string
+
+const (
+	FeedAtom FeedFormat = "atom"
+	FeedRSS FeedFormat = "rss"
+	FeedJSON FeedFormat = "json"
+)
+
+var FeedFormats = []FeedFormat{FeedAtom, FeedRSS, FeedJSON}
+
+func (format FeedFormat) MediaType() string {
+	switch format {
+	case FeedAtom: return "application/atom+xml"
+	case FeedRSS: return "application/rss+xml"
+	case FeedJSON: return "application/feed+json"
+	}
+	return "application/octet-stream"
+}
+
+func (format FeedFormat) ContentType() string {
+	return format.MediaType() + "; charset=utf-8"
+}
+
+type FeedOptions struct {
+	// Absolute URL the blog is served from, without trailing slash
+	BaseURL string
+	// Include the whole article instead of an excerpt
+	FullContent bool
+	// Maximum number of entries, 0 means no limit
+	Limit int
+	// Author of articles that do not name one
+	Author string
+}
+
+type Feed struct {
+	Title string
+	PageURL string
+	FeedURL string
+	Updated time.Time
+	Items []FeedItem
+}
+
+type FeedItem struct {
+	Id string
+	Title string
+	URL string
+	Author string
+	Tags []string
+	Summary string
+	Content HTML
+	Published time.Time
+	Updated time.Time
+}
+
+// Builds a feed from published articles. pagePath is the HTML page the feed
+// mirrors, feedPath the path of the feed itself.
+func NewFeed(title string, pagePath string, feedPath string, articles []Article, opts FeedOptions) Feed {
+	feed := Feed{
+		Title: title,
+		PageURL: opts.BaseURL + pagePath,
+		FeedURL: opts.BaseURL + feedPath,
+		Items: make([]FeedItem, 0, len(articles)),
+	}
+
+	sorted := sortArticlesNewestFirst(articles)
+	if opts.Limit > 0 && len(sorted) > opts.Limit {
+		sorted = sorted[:opts.Limit]
+	}
+
+	for _, article := range sorted {
+		link := opts.BaseURL + "/article/" + url.PathEscape(article.Name)
+		item := FeedItem{
+			Id: link,
+			Title: article.RawTitle,
+			URL: link,
+			Author: cmp.Or(article.Author, opts.Author),
+			Tags: article.Tags,
+			Summary: ArticleExcerpt(article),
+			Published: article.PublishDate(),
+			Updated: article.UpdatedAt,
+		}
+
+		if opts.FullContent {
+			item.Content = absoluteURLs(article.Content, link)
+		}
+
+		if item.Updated.Before(item.Published) {
+			item.Updated = item.Published
+		}
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed
+}
+
+// Link and image attributes of rendered markdown
+var urlAttribute = regexp.MustCompile(`(\s(?:href|src|poster)=")([^"]*)"`)
+
+// Resolves relative links and images of content against the URL of its page,
+// feed readers show entries away from the site where they would not resolve
+func absoluteURLs(content HTML, pageURL string) HTML {
+	base, err := url.Parse(pageURL)
+	if err != nil || !base.IsAbs() {
+		return content
+	}
+
+	return HTML(urlAttribute.ReplaceAllStringFunc(string(content), func(attr string) string {
+		match := urlAttribute.FindStringSubmatch(attr)
+		ref, err := url.Parse(gohtml.UnescapeString(match[2]))
+		if err != nil || ref.IsAbs() {
+			return attr
+		}
+		return match[1] + gohtml.EscapeString(base.ResolveReference(ref).String()) + `"`
+	}))
+}
+
+// Summary of the article with markup removed
+func ArticleExcerpt(article Article) string {
+	return strings.Join(strings.Fields(stripTags(string(article.Summary))), " ")
+}
+
+func stripTags(s string) string {
+	sb := strings.Builder{}
+	inTag := false
+
+	for _, c := range s {
+		switch {
+		case c == '<':
+			inTag = true
+		case c == '>' && inTag:
+			inTag = false
+			sb.WriteRune(' ')
+		case !inTag:
+			sb.WriteRune(c)
+		}
+	}
+
+	return gohtml.UnescapeString(sb.String())
+}
+
+func (feed Feed) Render(format FeedFormat) ([]byte, error) {
+	switch format {
+	case FeedAtom: return feed.Atom()
+	case FeedRSS: return feed.RSS()
+	case FeedJSON: return feed.JSON()
+	}
+	return nil, fmt.Errorf("unknown feed format %q", format)
+}
+
+type atomLink struct {
+	Rel string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id string `xml:"id"`
+	Title string `xml:"title"`
+	Links []atomLink `xml:"link"`
+	Author *atomAuthor `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Published string `xml:"published"`
+	Updated string `xml:"updated"`
+	Summary *atomText `xml:"summary,omitempty"`
+	Content *atomText `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Id string `xml:"id"`
+	Title string `xml:"title"`
+	Links []atomLink `xml:"link"`
+	Updated string `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (feed Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		Id: feed.FeedURL,
+		Title: feed.Title,
+		Links: []atomLink{
+			{Rel: "self", Type: FeedAtom.MediaType(), Href: feed.FeedURL},
+			{Rel: "alternate", Type: "text/html", Href: feed.PageURL},
+		},
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+	}
+
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			Id: item.Id,
+			Title: item.Title,
+			Links: []atomLink{{Rel: "alternate", Type: "text/html", Href: item.URL}},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated: item.Updated.UTC().Format(time.RFC3339),
+			Summary: &atomText{Type: "text", Body: item.Summary},
+		}
+
+		if item.Author != "" {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Body: string(item.Content)}
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshalXML(doc)
+}
+
+type rssGuid struct {
+	IsPermaLink bool `xml:"isPermaLink,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	Guid rssGuid `xml:"guid"`
+	Author string `xml:"http://purl.org/dc/elements/1.1/ creator,omitempty"`
+	Categories []string `xml:"category"`
+	PubDate string `xml:"pubDate"`
+	Description string `xml:"description"`
+	Content string `xml:"http://purl.org/rss/1.0/modules/content/ encoded,omitempty"`
+}
+
+type rssChannel struct {
+	Title string `xml:"title"`
+	Link string `xml:"link"`
+	Description string `xml:"description"`
+	AtomLink atomLink `xml:"http://www.w3.org/2005/Atom link"`
+	LastBuildDate string `xml:"lastBuildDate"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func (feed Feed) RSS() ([]byte, error) {
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title: feed.Title,
+			Link: feed.PageURL,
+			Description: feed.Title,
+			AtomLink: atomLink{Rel: "self", Type: FeedRSS.MediaType(), Href: feed.FeedURL},
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, item := range feed.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title: item.Title,
+			Link: item.URL,
+			Guid: rssGuid{IsPermaLink: true, Body: item.Id},
+			Author: item.Author,
+			Categories: item.Tags,
+			PubDate: item.Published.UTC().Format(time.RFC1123Z),
+			Description: item.Summary,
+			Content: string(item.Content),
+		})
+	}
+
+	return marshalXML(doc)
+}
+
+func marshalXML(doc any) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	Id string `json:"id"`
+	URL string `json:"url"`
+	Title string `json:"title"`
+	Summary string `json:"summary,omitempty"`
+	ContentHTML *string `json:"content_html,omitempty"`
+	ContentText string `json:"content_text,omitempty"`
+	DatePublished string `json:"date_published"`
+	DateModified string `json:"date_modified"`
+	Authors []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version string `json:"version"`
+	Title string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL string `json:"feed_url"`
+	Items []jsonFeedItem `json:"items"`
+}
+
+func (feed Feed) JSON() ([]byte, error) {
+	doc := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title: feed.Title,
+		HomePageURL: feed.PageURL,
+		FeedURL: feed.FeedURL,
+		Items: make([]jsonFeedItem, 0, len(feed.Items)),
+	}
+
+	for _, item := range feed.Items {
+		jsonItem := jsonFeedItem{
+			Id: item.Id,
+			URL: item.URL,
+			Title: item.Title,
+			Summary: item.Summary,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			DateModified: item.Updated.UTC().Format(time.RFC3339),
+			Tags: item.Tags,
+		}
+
+		// Items need either content_html or content_text
+		if item.Content == "" && item.Summary != "" {
+			jsonItem.ContentText = item.Summary
+		} else {
+			content := string(item.Content)
+			jsonItem.ContentHTML = &content
+		}
+		if item.Author != "" {
+			jsonItem.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+
+		doc.Items = append(doc.Items, jsonItem)
+	}
+
+	return json.MarshalIndent(doc, "", "\t")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"time"
+	"slices"
+	"strings"
+	"testing"
+	"encoding/xml"
+	"encoding/json"
+	"net/http/httptest"
+)
+
+func TestAbsoluteURLs(t *testing.T) {
+	page := "https://example.com/article/post"
+	tests := []struct {
+		content HTML
+		want HTML
+	}{
+		{`<a href="other">x</a>`, `<a href="https://example.com/article/other">x</a>`},
+		{`<a href="/about">x</a>`, `<a href="https://example.com/about">x</a>`},
+		{`<img src="img/a.png">`, `<img src="https://example.com/article/img/a.png">`},
+		{`<a href="#fn:1">1</a>`, `<a href="https://example.com/article/post#fn:1">1</a>`},
+		{`<a href="https://other.org/x">x</a>`, `<a href="https://other.org/x">x</a>`},
+		{`<a href="mailto:me@example.com">x</a>`, `<a href="mailto:me@example.com">x</a>`},
+		{`<a href="a?x=1&amp;y=2">x</a>`, `<a href="https://example.com/article/a?x=1&amp;y=2">x</a>`},
+		{`<p>href="not/an/attribute"</p>`, `<p>href="not/an/attribute"</p>`},
+	}
+
+	for _, test := range tests {
+		if got := absoluteURLs(test.content, page); got != test.want {
+			t.Errorf("absoluteURLs(%s) = %s, want %s", test.content, got, test.want)
+		}
+	}
+
+	if got := absoluteURLs(`<a href="x">x</a>`, "/article/post"); got != `<a href="x">x</a>` {
+		t.Errorf("relative page URL changed links: %s", got)
+	}
+}
+
+func testFeedArticles() []Article {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	return []Article{
+		{Name: "old", RawTitle: "Old", Summary: "<p>Old <em>text</em></p>", CreatedAt: day(1), UpdatedAt: day(8)},
+		{Name: "new", RawTitle: "New & shiny", Author: "Ann", Tags: StringList{"go"}, Content: `<a href="/x">x</a>`, PublishedAt: day(5), CreatedAt: day(1), UpdatedAt: day(2)},
+		{Name: "middle", RawTitle: "Middle", CreatedAt: day(3), UpdatedAt: day(3)},
+	}
+}
+
+func TestNewFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FeedOptions
+		names []string
+		updated int
+	}{
+		{"all", FeedOptions{BaseURL: "https://example.com", Author: "Site"}, []string{"new", "middle", "old"}, 8},
+		{"limit", FeedOptions{BaseURL: "https://example.com", Limit: 2}, []string{"new", "middle"}, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := NewFeed("Blog", "/", "/feed.atom", testFeedArticles(), test.opts)
+
+			names := make([]string, 0, len(feed.Items))
+			for _, item := range feed.Items {
+				names = append(names, strings.TrimPrefix(item.URL, "https://example.com/article/"))
+				if item.Updated.Before(item.Published) {
+					t.Errorf("%s updated before it was published", item.Title)
+				}
+			}
+			if !slices.Equal(names, test.names) {
+				t.Fatalf("items %v, want %v", names, test.names)
+			}
+			if feed.FeedURL != "https://example.com/feed.atom" || feed.PageURL != "https://example.com/" {
+				t.Errorf("feed URLs %s and %s", feed.FeedURL, feed.PageURL)
+			}
+			if feed.Updated.Day() != test.updated {
+				t.Errorf("feed updated %v, want day %d", feed.Updated, test.updated)
+			}
+			if feed.Items[0].Author != "Ann" || feed.Items[1].Author != test.opts.Author {
+				t.Errorf("authors %q and %q", feed.Items[0].Author, feed.Items[1].Author)
+			}
+		})
+	}
+
+	full := NewFeed("Blog", "/", "/feed.atom", testFeedArticles(), FeedOptions{BaseURL: "https://example.com", FullContent: true})
+	if full.Items[0].Content != `<a href="https://example.com/x">x</a>` {
+		t.Errorf("full content %s", full.Items[0].Content)
+	}
+	if full.Items[2].Summary != "Old text" {
+		t.Errorf("summary %q", full.Items[2].Summary)
+	}
+}
+
+// Every format must parse back with the titles of the items
+func TestFeedRender(t *testing.T) {
+	feed := NewFeed("Blog", "/", "/feed", testFeedArticles(), FeedOptions{BaseURL: "https://example.com"})
+	wantTitles := []string{"New & shiny", "Middle", "Old"}
+
+	for _, format := range FeedFormats {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := feed.Render(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			titles := make([]string, 0, 3)
+			switch format {
+			case FeedAtom:
+				doc := atomFeed{}
+				if err := xml.Unmarshal(data, &doc); err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range doc.Entries {
+					titles = append(titles, entry.Title)
+				}
+				if doc.Updated != "2024-03-08T00:00:00Z" {
+					t.Errorf("updated %s", doc.Updated)
+				}
+			case FeedRSS:
+				doc := rssFeed{}
+				if err := xml.Unmarshal(data, &doc); err != nil {
+					t.Fatal(err)
+				}
+				for _, item := range doc.Channel.Items {
+					titles = append(titles, item.Title)
+				}
+				if doc.Channel.Items[0].PubDate != "Tue, 05 Mar 2024 00:00:00 +0000" {
+					t.Errorf("pubDate %s", doc.Channel.Items[0].PubDate)
+				}
+			case FeedJSON:
+				doc := jsonFeed{}
+				if err := json.Unmarshal(data, &doc); err != nil {
+					t.Fatal(err)
+				}
+				for _, item := range doc.Items {
+					titles = append(titles, item.Title)
+					if item.ContentHTML == nil && item.ContentText == "" {
+						t.Errorf("%s has neither content_html nor content_text", item.Title)
+					}
+				}
+			}
+
+			if !slices.Equal(titles, wantTitles) {
+				t.Errorf("titles %q, want %q", titles, wantTitles)
+			}
+		})
+	}
+
+	if _, err := feed.Render("txt"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestFeedEndpoints(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "post", "---\ntitle: Post\ndate: 2024-03-05\ntags: [go]\n---\nText\n")
+	handler := newTestServer(t, repo, ServerOptions{Feed: FeedOptions{BaseURL: "https://example.com"}})
+
+	for _, dir := range []string{"/", "/tag/go/"} {
+		for _, format := range FeedFormats {
+			p := dir + "feed." + string(format)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", p, nil))
+
+			if rec.Code != 200 || rec.Header().Get("Content-Type") != format.ContentType() {
+				t.Errorf("%s: status %d, Content-Type %q", p, rec.Code, rec.Header().Get("Content-Type"))
+			}
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"strconv"
+)
+
+// Metadata block at the start of an article, delimited by "---" (YAML) or
+// "+++" (TOML). Only a small, flat subset of both formats is understood:
+// scalars, single level lists, YAML block scalars and TOML table headers.
+type FrontMatter struct {
+	Title string
+	Slug string
+	Description string
+	Tags []string
+	Author string
+	Date time.Time
+	Draft bool
+	// Heading levels in the table of contents, 0 disables it
+	TOCDepth int
+	Extra map[string]any
+}
+
+type FrontMatterError struct {
+	Line int
+	Msg string
+}
+
+func (e *FrontMatterError) Error() string {
+	return fmt.Sprintf("front matter line %d: %s", e.Line, e.Msg)
+}
+
+var frontMatterDateLayouts = []string {
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Splits source into its front matter block and the remaining markdown body.
+// delim is empty if the source has no front matter.
+func SplitFrontMatter(source string) (delim string, block string, body string) {
+	source = strings.TrimPrefix(source, "\ufeff")
+
+	for _, d := range []string{"---", "+++"} {
+		firstLine, rest, found := strings.Cut(source, "\n")
+		if !found || strings.TrimSpace(firstLine) != d {
+			continue
+		}
+
+		offset := 0
+		for offset <= len(rest) {
+			line, _, _ := strings.Cut(rest[offset:], "\n")
+			if strings.TrimSpace(line) == d {
+				block = rest[:offset]
+				body = rest[min(offset + len(line) + 1, len(rest)):]
+				return d, block, body
+			}
+			offset += len(line) + 1
+		}
+	}
+
+	return "", "", source
+}
+
+func ParseFrontMatter(source string) (fm FrontMatter, body string, err error) {
+	delim, block, body := SplitFrontMatter(source)
+
+	var fields map[string]any
+	switch delim {
+	case "---":
+		fields, err = parseYAMLFrontMatter(block)
+	case "+++":
+		fields, err = parseTOMLFrontMatter(block)
+	default:
+		fm.TOCDepth = DefaultTOCDepth
+		return fm, body, nil
+	}
+	if err != nil { return }
+
+	fm, err = frontMatterFromFields(fields)
+	return
+}
+
+func frontMatterFromFields(fields map[string]any) (fm FrontMatter, err error) {
+	fm.Extra = make(map[string]any)
+	fm.TOCDepth = DefaultTOCDepth
+
+	for key, value := range fields {
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title = frontMatterString(value)
+		case "slug":
+			fm.Slug = frontMatterString(value)
+		case "description":
+			fm.Description = frontMatterString(value)
+		case "author":
+			fm.Author = frontMatterString(value)
+		case "tags":
+			fm.Tags = toStringList(value)
+		case "draft":
+			fm.Draft, err = parseFrontMatterBool(value)
+			if err != nil {
+				return fm, fmt.Errorf("front matter: draft must be a boolean, got %q", fmt.Sprint(value))
+			}
+		case "date":
+			fm.Date, err = parseFrontMatterDate(fmt.Sprint(value))
+			if err != nil { return }
+		case "toc_depth":
+			depth, ok := value.(int64)
+			if !ok || depth < 0 || depth > 6 {
+				return fm, fmt.Errorf("front matter: toc_depth must be a number from 0 to 6, got %q", fmt.Sprint(value))
+			}
+			fm.TOCDepth = int(depth)
+		default:
+			fm.Extra[key] = value
+		}
+	}
+
+	return
+}
+
+func frontMatterString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(value))
+}
+
+// YAML 1.1 spellings of booleans are only understood for boolean keys,
+// anywhere else "no" or "on" stay strings
+func parseFrontMatterBool(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "yes", "on":
+			return true, nil
+		case "no", "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("not a boolean: %q", fmt.Sprint(value))
+}
+
+func parseFrontMatterDate(s string) (time.Time, error) {
+	for _, layout := range frontMatterDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("front matter: invalid date %q", s)
+}
+
+func toStringList(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	case string:
+		list := make([]string, 0, 4)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func parseYAMLFrontMatter(block string) (map[string]any, error) {
+	fields := make(map[string]any)
+	listKey := ""
+	lines := strings.Split(block, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		raw := stripComment(lines[i])
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		if line == "-" || strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return nil, &FrontMatterError{i + 1, "list item without a key"}
+			}
+			item := parseScalar(strings.TrimSpace(line[1:]))
+			fields[listKey] = append(fields[listKey].([]any), item)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, &FrontMatterError{i + 1, "expected 'key: value'"}
+		}
+		if raw[0] == ' ' || raw[0] == '\t' {
+			return nil, &FrontMatterError{i + 1, "nested maps are not supported"}
+		}
+		key, value = unquoteKey(strings.TrimSpace(key)), strings.TrimSpace(value)
+		listKey = ""
+
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			text, n, err := parseBlockScalar(value, lines[i + 1:])
+			if err != nil {
+				return nil, &FrontMatterError{i + 1, err.Error()}
+			}
+			fields[key] = text
+			i += n
+			continue
+		}
+
+		if value == "" {
+			if frontMatterStringKeys[strings.ToLower(key)] {
+				fields[key] = ""
+				continue
+			}
+			fields[key] = []any{}
+			listKey = key
+			continue
+		}
+
+		v, err := parseFieldValue(key, value)
+		if err != nil {
+			return nil, &FrontMatterError{i + 1, err.Error()}
+		}
+		fields[key] = v
+	}
+
+	return fields, nil
+}
+
+// Reads the indented lines of a literal (|) or folded (>) block scalar
+// following its header, returns the text and the number of lines it spans.
+func parseBlockScalar(header string, lines []string) (string, int, error) {
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", 0, fmt.Errorf("unsupported block scalar header %q", header)
+	}
+
+	indent := 0
+	n := 0
+	for ; n < len(lines); n++ {
+		line := strings.TrimRight(lines[n], " \t\r")
+		if line == "" {
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 {
+			indent = lineIndent
+		}
+		if lineIndent == 0 || lineIndent < indent {
+			break
+		}
+	}
+
+	body := make([]string, 0, n)
+	for _, line := range lines[:n] {
+		line = strings.TrimRight(line, " \t\r")
+		if line != "" {
+			line = line[indent:]
+		}
+		body = append(body, line)
+	}
+
+	// Trailing blank lines are only kept with the '+' chomping indicator
+	blank := 0
+	for len(body) > 0 && body[len(body) - 1] == "" {
+		body = body[:len(body) - 1]
+		blank += 1
+	}
+
+	var text strings.Builder
+	for j, line := range body {
+		if j == 0 {
+			text.WriteString(line)
+			continue
+		}
+		previous := body[j - 1]
+		switch {
+		case style == '|':
+			text.WriteString("\n")
+		case line == "" || previous == "":
+			// A blank line in a folded scalar is a line break
+		case previous[0] == ' ' || line[0] == ' ':
+			// More indented lines keep their line breaks
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		if style == '>' && line == "" {
+			text.WriteString("\n")
+			continue
+		}
+		text.WriteString(line)
+	}
+
+	if text.Len() == 0 {
+		return "", n, nil
+	}
+	switch chomp {
+	case "-":
+	case "+":
+		text.WriteString(strings.Repeat("\n", blank + 1))
+	default:
+		text.WriteString("\n")
+	}
+	return text.String(), n, nil
+}
+
+func parseTOMLFrontMatter(block string) (map[string]any, error) {
+	fields := make(map[string]any)
+	table := fields
+	pending := ""
+	pendingKey := ""
+	pendingLine := 0
+
+	for i, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+
+		// Multi line arrays are accumulated until their brackets balance
+		if pendingKey != "" {
+			pending += " " + line
+			if bracketDepth(pending) > 0 {
+				continue
+			}
+			v, err := parseValue(pending)
+			if err != nil {
+				return nil, &FrontMatterError{pendingLine, err.Error()}
+			}
+			table[pendingKey] = v
+			pending, pendingKey = "", ""
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := unquoteKey(strings.TrimSpace(line[1:len(line) - 1]))
+			table = make(map[string]any)
+			fields[name] = table
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, &FrontMatterError{i + 1, "expected 'key = value'"}
+		}
+		key, value = unquoteKey(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if value == "" {
+			return nil, &FrontMatterError{i + 1, "expected a value after '='"}
+		}
+
+		if bracketDepth(value) > 0 {
+			pending, pendingKey, pendingLine = value, key, i + 1
+			continue
+		}
+
+		v, err := parseFieldValue(key, value)
+		if err != nil {
+			return nil, &FrontMatterError{i + 1, err.Error()}
+		}
+		table[key] = v
+	}
+
+	if pendingKey != "" {
+		return nil, &FrontMatterError{pendingLine, "unterminated array"}
+	}
+
+	return fields, nil
+}
+
+// Removes a trailing '#' comment. Like in YAML and TOML a comment starts at
+// the beginning of the line or after whitespace, never inside a quoted string
+// or a list, so "C# tips" and [c#] are kept.
+func stripComment(line string) string {
+	quote := byte(0)
+	depth := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth += 1
+		case c == ']':
+			depth -= 1
+		case c == '#' && depth <= 0 && (i == 0 || line[i - 1] == ' ' || line[i - 1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func bracketDepth(s string) int {
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth += 1
+		case c == ']':
+			depth -= 1
+		}
+	}
+	return depth
+}
+
+func unquoteKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key) - 1] == key[0] {
+		return key[1:len(key) - 1]
+	}
+	return key
+}
+
+// Title, description and the like stay strings even when they look like a
+// number or a boolean
+var frontMatterStringKeys = map[string]bool{
+	"title": true,
+	"slug": true,
+	"description": true,
+	"author": true,
+}
+
+func parseFieldValue(key string, value string) (any, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing value of %q", key)
+	}
+	if frontMatterStringKeys[strings.ToLower(key)] && !strings.HasPrefix(value, "[") {
+		if value[0] == '"' || value[0] == '\'' {
+			return parseScalar(value), nil
+		}
+		return value, nil
+	}
+	return parseValue(value)
+}
+
+func parseValue(s string) (any, error) {
+	if strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("nested maps are not supported")
+	}
+	if !strings.HasPrefix(s, "[") {
+		return parseScalar(s), nil
+	}
+
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("malformed list %q", s)
+	}
+
+	items := make([]any, 0, 4)
+	for _, item := range splitList(s[1:len(s) - 1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		v, err := parseValue(item)
+		if err != nil { return nil, err }
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// Splits on commas that are not inside quotes or nested lists.
+func splitList(s string) []string {
+	items := make([]string, 0, 4)
+	depth := 0
+	quote := byte(0)
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth += 1
+		case c == ']':
+			depth -= 1
+		case c == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, s[start:])
+}
+
+func parseScalar(s string) any {
+	if len(s) >= 2 && s[0] == '"' && s[len(s) - 1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1:len(s) - 1]
+	}
+
+	if len(s) >= 2 && s[0] == '\'' && s[len(s) - 1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s) - 1], "''", "'")
+	}
+
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null", "~":
+		return nil
+	}
+
+	number := strings.ReplaceAll(s, "_", "")
+	if v, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(number, 64); err == nil {
+		return v
+	}
+
+	return s
+}
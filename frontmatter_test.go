@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		want FrontMatter
+		extra map[string]any
+	}{
+		{
+			name: "yaml hash inside a word",
+			source: "---\ntitle: C# tips\n---\n",
+			want: FrontMatter{Title: "C# tips"},
+		},
+		{
+			name: "yaml hash inside a flow list",
+			source: "---\ntags: [c#, go]\n---\n",
+			want: FrontMatter{Tags: []string{"c#", "go"}},
+		},
+		{
+			name: "yaml hash inside quotes",
+			source: "---\ntitle: \"# not a comment\"\n---\n",
+			want: FrontMatter{Title: "# not a comment"},
+		},
+		{
+			name: "yaml trailing comment",
+			source: "---\n# leading comment\ntitle: Hello # comment\ntags:\n  - c# # comment\n---\n",
+			want: FrontMatter{Title: "Hello", Tags: []string{"c#"}},
+		},
+		{
+			name: "yaml string fields stay strings",
+			source: "---\ntitle: yes\nauthor: no\ndescription: on\nslug: 1.0\n---\n",
+			want: FrontMatter{Title: "yes", Author: "no", Description: "on", Slug: "1.0"},
+		},
+		{
+			name: "yaml draft yes",
+			source: "---\ndraft: yes\n---\n",
+			want: FrontMatter{Draft: true},
+		},
+		{
+			name: "yaml draft off",
+			source: "---\ndraft: off\n---\n",
+			want: FrontMatter{Draft: false},
+		},
+		{
+			name: "yaml extra keys are not coerced",
+			source: "---\ncomments: no\nfeatured: true\n---\n",
+			want: FrontMatter{},
+			extra: map[string]any{"comments": "no", "featured": true},
+		},
+		{
+			name: "yaml folded block scalar",
+			source: "---\ndescription: >\n  A long\n  description\n\n  in two paragraphs\ntitle: After\n---\n",
+			want: FrontMatter{Title: "After", Description: "A long description\nin two paragraphs"},
+		},
+		{
+			name: "yaml literal block scalar",
+			source: "---\nnote: |\n  line one\n    indented # kept\n  line three\n\ntitle: After\n---\n",
+			want: FrontMatter{Title: "After"},
+			extra: map[string]any{"note": "line one\n  indented # kept\nline three\n"},
+		},
+		{
+			name: "yaml block scalar chomping",
+			source: "---\nstrip: |-\n  text\n\nkeep: |+\n  text\n\nclip: >\n  text\n\n---\n",
+			want: FrontMatter{},
+			extra: map[string]any{"strip": "text", "keep": "text\n\n", "clip": "text\n"},
+		},
+		{
+			name: "toml hash inside a word",
+			source: "+++\ntitle = \"C# tips\" # comment\ntags = [\"c#\"]\n+++\n",
+			want: FrontMatter{Title: "C# tips", Tags: []string{"c#"}},
+		},
+		{
+			name: "toml multi line array",
+			source: "+++\ntags = [\n  \"a\", # first\n  \"b\",\n]\ndraft = true\n+++\n",
+			want: FrontMatter{Tags: []string{"a", "b"}, Draft: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fm, _, err := ParseFrontMatter(test.source)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			test.want.TOCDepth = DefaultTOCDepth
+			if fm.Title != test.want.Title || fm.Slug != test.want.Slug ||
+				fm.Description != test.want.Description || fm.Author != test.want.Author ||
+				fm.Draft != test.want.Draft || fm.TOCDepth != test.want.TOCDepth ||
+				!slices.Equal(fm.Tags, test.want.Tags) {
+				t.Errorf("got %+v, want %+v", fm, test.want)
+			}
+
+			for key, want := range test.extra {
+				if got := fm.Extra[key]; got != want {
+					t.Errorf("extra %q: got %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFrontMatterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		// Line inside the front matter block
+		line int
+	}{
+		{"yaml nested map", "---\ntitle: Hello\nseries:\n  name: Go\n  part: 2\n---\n", 3},
+		{"yaml flow map", "---\nseries: {name: Go}\n---\n", 1},
+		{"yaml list item without key", "---\n- item\n---\n", 1},
+		{"yaml missing colon", "---\ntitle\n---\n", 1},
+		{"yaml bad block scalar header", "---\ndescription: >x\n  text\n---\n", 1},
+		{"toml inline table", "+++\nseries = {name = \"Go\"}\n+++\n", 1},
+		{"toml unterminated array", "+++\ntags = [\"a\",\n+++\n", 1},
+		{"toml empty string key", "+++\ntitle =\n+++\n", 1},
+		{"toml empty value", "+++\ntitle = \"Hi\"\ndraft = \n+++\n", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ParseFrontMatter(test.source)
+			var fmErr *FrontMatterError
+			if !errors.As(err, &fmErr) {
+				t.Fatalf("got %v, want a FrontMatterError", err)
+			}
+			if fmErr.Line != test.line {
+				t.Errorf("error on line %d, want %d: %v", fmErr.Line, test.line, err)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatterDraftNotBoolean(t *testing.T) {
+	_, _, err := ParseFrontMatter("---\ndraft: maybe\n---\n")
+	if err == nil {
+		t.Fatal("expected an error for a non boolean draft")
+	}
+}
@@ -3,6 +3,7 @@ module marcs-feh/blog
 go 1.23.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/go-chi/chi/v5 v5.2.3
 	github.com/gomarkdown/markdown v0.0.0-20250810172220-2e2c11897d1a
 	github.com/jmoiron/sqlx v1.4.0
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"html/template"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Lexical rules of a language, enough to tell keywords, strings, comments
+// and numbers apart. Tokens are emitted as <span class="hl-...">.
+type codeLanguage struct {
+	keywords map[string]bool
+	types map[string]bool
+	builtins map[string]bool
+	lineComments []string
+	blockComment [2]string
+	// Strings with backslash escapes
+	quotes string
+	// Strings without escapes, may span lines
+	rawQuotes string
+	tripleQuotes bool
+	multilineStrings bool
+	// '#' at the start of a line begins a preprocessor directive
+	preprocessor bool
+	// Prefix of directives and attributes, e.g. #force_inline or @property
+	directive byte
+	// Shell style $name and ${name} variables
+	variables bool
+	ignoreCase bool
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+var cLanguage = &codeLanguage{
+	keywords: wordSet(`auto break case const continue default do else enum extern for goto if
+		inline register restrict return sizeof static struct switch typedef union volatile while
+		_Alignas _Alignof _Atomic _Generic _Noreturn _Static_assert _Thread_local
+		alignas alignof static_assert thread_local nullptr true false NULL`),
+	types: wordSet(`void char short int long float double signed unsigned bool _Bool
+		size_t ssize_t ptrdiff_t intptr_t uintptr_t int8_t int16_t int32_t int64_t
+		uint8_t uint16_t uint32_t uint64_t FILE`),
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `"'`,
+	preprocessor: true,
+}
+
+var cppLanguage = &codeLanguage{
+	keywords: wordSet(`auto break case catch class const constexpr consteval const_cast continue
+		co_await co_return co_yield decltype default delete do dynamic_cast else enum explicit
+		export extern for friend goto if inline mutable namespace new noexcept operator private
+		protected public reinterpret_cast return sizeof static static_assert static_cast struct
+		switch template this throw try typedef typeid typename union using virtual volatile while
+		true false nullptr NULL`),
+	types: wordSet(`void char char8_t char16_t char32_t short int long float double signed
+		unsigned bool wchar_t size_t ptrdiff_t int8_t int16_t int32_t int64_t uint8_t uint16_t
+		uint32_t uint64_t`),
+	builtins: wordSet(`std`),
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `"'`,
+	preprocessor: true,
+}
+
+var goLanguage = &codeLanguage{
+	keywords: wordSet(`break case chan const continue default defer else fallthrough for func go
+		goto if import interface map package range return select struct switch type var
+		true false nil iota`),
+	types: wordSet(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32
+		int64 rune string uint uint8 uint16 uint32 uint64 uintptr any comparable`),
+	builtins: wordSet(`append cap clear close complex copy delete imag len make max min new panic
+		print println real recover`),
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `"'`,
+	rawQuotes: "`",
+}
+
+var odinLanguage = &codeLanguage{
+	keywords: wordSet(`asm auto_cast bit_set break case cast context continue defer distinct do
+		dynamic else enum fallthrough for foreign if import in map matrix not_in or_else
+		or_return or_break or_continue package proc return struct switch transmute typeid
+		union using when where true false nil`),
+	types: wordSet(`bool b8 b16 b32 b64 int i8 i16 i32 i64 i128 uint u8 u16 u32 u64 u128 uintptr
+		f16 f32 f64 complex32 complex64 complex128 quaternion64 quaternion128 quaternion256
+		rune string cstring rawptr any byte`),
+	builtins: wordSet(`len cap size_of align_of offset_of type_of type_info_of typeid_of min max
+		abs clamp make new free delete append clear copy swizzle raw_data`),
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `"'`,
+	rawQuotes: "`",
+	directive: '#',
+}
+
+var pythonLanguage = &codeLanguage{
+	keywords: wordSet(`and as assert async await break class continue def del elif else except
+		finally for from global if import in is lambda match case nonlocal not or pass raise
+		return try while with yield True False None self`),
+	types: wordSet(`int float complex str bytes bytearray bool list tuple dict set frozenset
+		object type`),
+	builtins: wordSet(`abs all any enumerate filter getattr hasattr input isinstance iter len map
+		max min next open print range repr reversed round setattr sorted sum super zip`),
+	lineComments: []string{"#"},
+	quotes: `"'`,
+	tripleQuotes: true,
+	directive: '@',
+}
+
+var shellLanguage = &codeLanguage{
+	keywords: wordSet(`if then else elif fi case esac for while until do done in function
+		select return break continue local export readonly declare set unset shift`),
+	builtins: wordSet(`cd echo printf read source exit eval exec test true false pwd cat grep
+		sed awk find ls cp mv rm mkdir git go make sudo`),
+	lineComments: []string{"#"},
+	quotes: `"`,
+	rawQuotes: `'`,
+	multilineStrings: true,
+	variables: true,
+}
+
+var javascriptLanguage = &codeLanguage{
+	keywords: wordSet(`async await break case catch class const continue debugger default delete
+		do else export extends finally for from function if import in instanceof let new of
+		return static super switch this throw try typeof var void while with yield
+		true false null undefined`),
+	builtins: wordSet(`console document window Array Object String Number Boolean Promise Map Set
+		JSON Math Date Error`),
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `"'`,
+	rawQuotes: "`",
+}
+
+var sqlLanguage = &codeLanguage{
+	keywords: wordSet(`select from where and or not insert into values update set delete create
+		table index view trigger drop alter add column primary key foreign references on
+		join inner left right outer cross group by order having limit offset as distinct union
+		all case when then else end is null in like between exists unique default begin commit
+		rollback transaction if with asc desc returning cascade`),
+	types: wordSet(`integer int text real blob numeric boolean datetime varchar char`),
+	builtins: wordSet(`count sum avg min max coalesce length lower upper substr replace
+		datetime strftime json_each`),
+	lineComments: []string{"--"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes: `'"`,
+	ignoreCase: true,
+}
+
+var jsonLanguage = &codeLanguage{
+	keywords: wordSet(`true false null`),
+	quotes: `"`,
+}
+
+var codeLanguages = map[string]*codeLanguage{
+	"c": cLanguage,
+	"h": cLanguage,
+	"cpp": cppLanguage,
+	"c++": cppLanguage,
+	"cc": cppLanguage,
+	"hpp": cppLanguage,
+	"go": goLanguage,
+	"golang": goLanguage,
+	"odin": odinLanguage,
+	"python": pythonLanguage,
+	"py": pythonLanguage,
+	"sh": shellLanguage,
+	"shell": shellLanguage,
+	"bash": shellLanguage,
+	"zsh": shellLanguage,
+	"console": shellLanguage,
+	"js": javascriptLanguage,
+	"javascript": javascriptLanguage,
+	"sql": sqlLanguage,
+	"json": jsonLanguage,
+}
+
+type codeToken struct {
+	Class string
+	Text string
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lineEnd(code string, i int) int {
+	if n := strings.IndexByte(code[i:], '\n'); n >= 0 {
+		return i + n
+	}
+	return len(code)
+}
+
+func (lang *codeLanguage) stringEnd(code string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(code); j++ {
+		switch {
+		case escapes && code[j] == '\\':
+			j += 1
+		case code[j] == quote:
+			return j + 1
+		case code[j] == '\n' && escapes && !lang.multilineStrings:
+			return j
+		}
+	}
+	return len(code)
+}
+
+func (lang *codeLanguage) classify(word string, call bool) string {
+	if lang.ignoreCase {
+		word = strings.ToLower(word)
+	}
+
+	switch {
+	case lang.keywords[word]:
+		return "keyword"
+	case lang.types[word]:
+		return "type"
+	case lang.builtins[word]:
+		return "builtin"
+	case call:
+		return "function"
+	}
+	return ""
+}
+
+// Splits code into classed tokens, lang may be nil for plain text
+func TokenizeCode(lang *codeLanguage, code string) []codeToken {
+	tokens := make([]codeToken, 0, 64)
+	i := 0
+	lineStart := true
+
+	emit := func(class string, end int){
+		// Merging keeps multibyte characters and runs of punctuation together
+		if n := len(tokens); n > 0 && tokens[n - 1].Class == class {
+			tokens[n - 1].Text += code[i:end]
+		} else {
+			tokens = append(tokens, codeToken{Class: class, Text: code[i:end]})
+		}
+		i = end
+	}
+
+	if lang == nil {
+		emit("", len(code))
+		return tokens
+	}
+
+	for i < len(code) {
+		c := code[i]
+		rest := code[i:]
+
+		if c == '\n' {
+			emit("", i + 1)
+			lineStart = true
+			continue
+		}
+		if c == ' ' || c == '\t' {
+			j := i
+			for j < len(code) && (code[j] == ' ' || code[j] == '\t') {
+				j += 1
+			}
+			emit("", j)
+			continue
+		}
+
+		wordStart := i == 0 || code[i - 1] == ' ' || code[i - 1] == '\t' || code[i - 1] == '\n'
+
+		switch {
+		case lang.preprocessor && lineStart && c == '#':
+			emit("preproc", lineEnd(code, i))
+
+		case lang.hasLineComment(rest) && (!lang.variables || wordStart):
+			emit("comment", lineEnd(code, i))
+
+		case lang.blockComment[0] != "" && strings.HasPrefix(rest, lang.blockComment[0]):
+			start, end := lang.blockComment[0], lang.blockComment[1]
+			if n := strings.Index(code[i + len(start):], end); n >= 0 {
+				emit("comment", i + len(start) + n + len(end))
+			} else {
+				emit("comment", len(code))
+			}
+
+		case lang.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`)):
+			if n := strings.Index(code[i + 3:], rest[:3]); n >= 0 {
+				emit("string", i + 3 + n + 3)
+			} else {
+				emit("string", len(code))
+			}
+
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			emit("string", lang.stringEnd(code, i, c, true))
+
+		case strings.IndexByte(lang.rawQuotes, c) >= 0:
+			emit("string", lang.stringEnd(code, i, c, false))
+
+		case isDigit(c):
+			j := i + 1
+			for j < len(code) && (isIdentChar(code[j]) || (code[j] == '.' && j + 1 < len(code) && isDigit(code[j + 1]))) {
+				j += 1
+			}
+			emit("number", j)
+
+		case lang.directive != 0 && c == lang.directive && i + 1 < len(code) && isIdentStart(code[i + 1]):
+			j := i + 1
+			for j < len(code) && isIdentChar(code[j]) {
+				j += 1
+			}
+			emit("preproc", j)
+
+		case lang.variables && c == '$' && i + 1 < len(code):
+			j := i + 1
+			if code[j] == '{' {
+				if n := strings.IndexByte(code[j:], '}'); n >= 0 {
+					j += n + 1
+				}
+			} else if isIdentStart(code[j]) {
+				for j < len(code) && isIdentChar(code[j]) {
+					j += 1
+				}
+			} else if strings.IndexByte("0123456789#?@*$!-", code[j]) >= 0 {
+				j += 1
+			}
+			emit("variable", j)
+
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(code) && isIdentChar(code[j]) {
+				j += 1
+			}
+			call := j < len(code) && code[j] == '('
+			emit(lang.classify(code[i:j], call), j)
+
+		default:
+			emit("", i + 1)
+		}
+
+		lineStart = false
+	}
+
+	return tokens
+}
+
+func (lang *codeLanguage) hasLineComment(s string) bool {
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parsed fence info string, e.g. "c {3-5,8} linenos"
+type CodeInfo struct {
+	Language string
+	LineNumbers bool
+	Highlighted map[int]bool
+}
+
+func ParseCodeInfo(info string) CodeInfo {
+	result := CodeInfo{Highlighted: make(map[int]bool)}
+
+	fields := strings.FieldsFunc(info, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	})
+
+	for i, field := range fields {
+		braced := strings.HasPrefix(field, "{") || strings.HasSuffix(field, "}")
+		field = strings.Trim(field, "{}")
+
+		start, end, isLines := parseLineRange(field)
+
+		switch {
+		case isLines:
+			for line := start; line <= end && line - start < 10000; line++ {
+				result.Highlighted[line] = true
+			}
+		case field == "linenos":
+			result.LineNumbers = true
+		case i == 0 && !braced:
+			result.Language = strings.ToLower(field)
+		}
+	}
+
+	return result
+}
+
+// Parses "3" or "3-5"
+func parseLineRange(s string) (start int, end int, ok bool) {
+	first, last, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(first)
+	if err != nil { return 0, 0, false }
+
+	end = start
+	if isRange {
+		end, err = strconv.Atoi(last)
+		if err != nil { return 0, 0, false }
+	}
+	return start, end, true
+}
+
+// Splits tokens into lines, tokens spanning several lines are cut in pieces
+func splitTokenLines(tokens []codeToken) [][]codeToken {
+	lines := [][]codeToken{nil}
+
+	for _, token := range tokens {
+		for k, part := range strings.Split(token.Text, "\n") {
+			if k > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				last := len(lines) - 1
+				lines[last] = append(lines[last], codeToken{Class: token.Class, Text: part})
+			}
+		}
+	}
+
+	// The code of a block ends with a newline
+	if len(lines) > 1 && lines[len(lines) - 1] == nil {
+		lines = lines[:len(lines) - 1]
+	}
+
+	return lines
+}
+
+// Renders a fenced code block with highlighted tokens, every line is wrapped
+// in a span so it can be numbered and marked.
+func renderCodeBlock(w io.Writer, block *ast.CodeBlock) (ast.WalkStatus, bool) {
+	if !block.IsFenced || len(block.Info) == 0 {
+		return ast.GoToNext, false
+	}
+
+	info := ParseCodeInfo(string(block.Info))
+	tokens := TokenizeCode(codeLanguages[info.Language], string(block.Literal))
+
+	class := "code"
+	if info.LineNumbers {
+		class += " line-numbers"
+	}
+	io.WriteString(w, "\n<pre class=\"" + class + "\"><code")
+	if info.Language != "" {
+		io.WriteString(w, " class=\"language-" + template.HTMLEscapeString(info.Language) + "\"")
+	}
+	io.WriteString(w, ">")
+
+	for i, line := range splitTokenLines(tokens) {
+		number := i + 1
+
+		lineClass := "line"
+		if info.Highlighted[number] {
+			lineClass += " highlighted"
+		}
+		io.WriteString(w, "<span class=\"" + lineClass + "\" data-line=\"" + strconv.Itoa(number) + "\">")
+
+		for _, token := range line {
+			if token.Class == "" {
+				template.HTMLEscape(w, []byte(token.Text))
+				continue
+			}
+			io.WriteString(w, "<span class=\"hl-" + token.Class + "\">")
+			template.HTMLEscape(w, []byte(token.Text))
+			io.WriteString(w, "</span>")
+		}
+
+		io.WriteString(w, "</span>\n")
+	}
+
+	io.WriteString(w, "</code></pre>\n")
+	return ast.GoToNext, true
+}
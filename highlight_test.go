@@ -0,0 +1,137 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCodeInfo(t *testing.T) {
+	tests := []struct {
+		info string
+		language string
+		lineNumbers bool
+		highlighted []int
+	}{
+		{"go", "go", false, nil},
+		{"Go linenos", "go", true, nil},
+		{"c {3-5,8} linenos", "c", true, []int{3, 4, 5, 8}},
+		{"{2}", "", false, []int{2}},
+		{"python {1, 3}", "python", false, []int{1, 3}},
+		{"sh {x-y}", "sh", false, nil},
+		{"", "", false, nil},
+	}
+
+	for _, test := range tests {
+		info := ParseCodeInfo(test.info)
+		highlighted := slices.Sorted(maps.Keys(info.Highlighted))
+		if info.Language != test.language || info.LineNumbers != test.lineNumbers || !slices.Equal(highlighted, test.highlighted) {
+			t.Errorf("ParseCodeInfo(%q) = %q %v %v, want %q %v %v", test.info,
+				info.Language, info.LineNumbers, highlighted, test.language, test.lineNumbers, test.highlighted)
+		}
+	}
+}
+
+// Writes the classed tokens as "class:text", unclassed ones are left out
+func formatTokens(tokens []codeToken) string {
+	parts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Class != "" {
+			parts = append(parts, token.Class + ":" + token.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTokenizeCode(t *testing.T) {
+	tests := []struct {
+		language string
+		code string
+		want string
+	}{
+		{"go", "func main() { return 42 }", "keyword:func function:main keyword:return number:42"},
+		{"go", "var s string = `raw\n\"x\"` // done", "keyword:var type:string string:`raw\n\"x\"` comment:// done"},
+		{"go", `x := "a \" b"`, `string:"a \" b"`},
+		{"c", "#include <stdio.h>\nint x = 0x1F; /* c */", "preproc:#include <stdio.h> type:int number:0x1F comment:/* c */"},
+		{"c", "a = 1; # not a directive", "number:1"},
+		{"python", "def f():\n    '''doc\n    string'''\n    return None # x", "keyword:def function:f string:'''doc\n    string''' keyword:return keyword:None comment:# x"},
+		{"sh", "echo ${HOME} $1 a#b # c", "builtin:echo variable:${HOME} variable:$1 comment:# c"},
+		{"sql", "SELECT Name FROM Article", "keyword:SELECT keyword:FROM"},
+		{"sql", "select 1 -- comment", "keyword:select number:1 comment:-- comment"},
+		{"json", `{"a": true, "b": 1.5}`, `string:"a" keyword:true string:"b" number:1.5`},
+		{"odin", "#force_inline proc", "preproc:#force_inline keyword:proc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.language + " " + test.code, func(t *testing.T) {
+			lang := codeLanguages[test.language]
+			if lang == nil {
+				t.Fatalf("no language %q", test.language)
+			}
+			tokens := TokenizeCode(lang, test.code)
+
+			if got := formatTokens(tokens); got != test.want {
+				t.Errorf("tokens\n%s\nwant\n%s", got, test.want)
+			}
+
+			text := ""
+			for _, token := range tokens {
+				text += token.Text
+			}
+			if text != test.code {
+				t.Errorf("tokens make up %q, want the code", text)
+			}
+		})
+	}
+}
+
+func TestRenderCodeBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		contains []string
+	}{
+		{
+			name: "highlighted lines",
+			source: "```go {2} linenos\na := 1\nb := \"<x>\"\n```\n",
+			contains: []string{
+				`<pre class="code line-numbers"><code class="language-go">`,
+				`<span class="line" data-line="1">a := <span class="hl-number">1</span></span>`,
+				`<span class="line highlighted" data-line="2">b := <span class="hl-string">&#34;&lt;x&gt;&#34;</span></span>`,
+			},
+		},
+		{
+			name: "unknown language",
+			source: "```brainfuck\n+[<]\n```\n",
+			contains: []string{`<code class="language-brainfuck"><span class="line" data-line="1">+[&lt;]</span>`},
+		},
+		{
+			name: "string across lines",
+			source: "```go\ns := `a\nb`\n```\n",
+			contains: []string{
+				`<span class="line" data-line="1">s := <span class="hl-string">` + "`a</span></span>",
+				`<span class="line" data-line="2"><span class="hl-string">b` + "`</span></span>",
+			},
+		},
+		{
+			name: "without info",
+			source: "```\nplain\n```\n",
+			contains: []string{"<pre><code>plain\n</code></pre>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("code", test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range test.contains {
+				if !strings.Contains(string(article.Content), s) {
+					t.Errorf("content is missing\n%s\nin\n%s", s, article.Content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,738 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"html/template"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// Converts the TeX math subset commonly used in articles to MathML, which
+// browsers render natively.
+
+type MathError struct {
+	Offset int
+	Msg string
+}
+
+func (e *MathError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Offset)
+}
+
+var mathIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ", "hbar": "ℏ", "emptyset": "∅",
+	"varnothing": "∅", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ", "imath": "ı", "jmath": "ȷ",
+}
+
+// Upright identifiers
+var mathUprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+var mathOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "le": "≤", "leq": "≤", "ge": "≥", "geq": "≥", "ne": "≠",
+	"neq": "≠", "approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂",
+	"supset": "⊃", "subseteq": "⊆", "supseteq": "⊇", "cup": "∪", "cap": "∩", "wedge": "∧",
+	"land": "∧", "vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬", "forall": "∀", "exists": "∃",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "Rightarrow": "⇒",
+	"Leftarrow": "⇐", "leftrightarrow": "↔", "Leftrightarrow": "⇔", "iff": "⟺",
+	"implies": "⟹", "mapsto": "↦", "perp": "⊥", "parallel": "∥", "mid": "∣", "ldots": "…",
+	"dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "angle": "∠", "oplus": "⊕",
+	"otimes": "⊗", "setminus": "∖", "prime": "′", "colon": ":", "triangle": "△",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖",
+	"{": "{", "}": "}", "|": "‖", "%": "%", "&": "&", "#": "#", "$": "$", "_": "_",
+}
+
+// Operators whose scripts go above and below in display math
+var mathLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁",
+	"bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+}
+
+var mathIntegrals = map[string]string{
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+var mathFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true,
+	"log": true, "ln": true, "lg": true, "exp": true, "deg": true, "dim": true, "ker": true,
+	"arg": true, "gcd": true, "Pr": true, "hom": true,
+}
+
+var mathLimitFunctions = map[string]bool{
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "argmax": true, "argmin": true,
+}
+
+var mathAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→", "tilde": "~",
+	"widetilde": "~", "dot": "˙", "ddot": "¨", "overrightarrow": "→",
+}
+
+var mathSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", "!": "-0.1667em",
+	" ": "0.25em", "quad": "1em", "qquad": "2em",
+}
+
+var mathDelimiterSizes = map[string]string{
+	"big": "1.2em", "Big": "1.623em", "bigg": "2.047em", "Bigg": "2.470em",
+}
+
+type mathFont struct {
+	upper, lower, digits rune
+	exceptions map[rune]rune
+}
+
+// Styled letters are separate code points in the Mathematical Alphanumeric
+// Symbols block, mathvariant is not supported by browsers
+var mathFonts = map[string]mathFont{
+	"mathbf": {0x1D400, 0x1D41A, 0x1D7CE, nil},
+	"boldsymbol": {0x1D468, 0x1D482, 0x1D7CE, nil},
+	"mathit": {0x1D434, 0x1D44E, 0, map[rune]rune{'h': 0x210E}},
+	"mathcal": {0x1D49C, 0x1D4B6, 0, map[rune]rune{
+		'B': 0x212C, 'E': 0x2130, 'F': 0x2131, 'H': 0x210B, 'I': 0x2110, 'L': 0x2112,
+		'M': 0x2133, 'R': 0x211B, 'e': 0x212F, 'g': 0x210A, 'o': 0x2134,
+	}},
+	"mathbb": {0x1D538, 0x1D552, 0x1D7D8, map[rune]rune{
+		'C': 0x2102, 'H': 0x210D, 'N': 0x2115, 'P': 0x2119, 'Q': 0x211A, 'R': 0x211D, 'Z': 0x2124,
+	}},
+	"mathfrak": {0x1D504, 0x1D51E, 0, map[rune]rune{
+		'C': 0x212D, 'H': 0x210C, 'I': 0x2111, 'R': 0x211C, 'Z': 0x2128,
+	}},
+	"mathsf": {0x1D5A0, 0x1D5BA, 0x1D7E2, nil},
+	"mathtt": {0x1D670, 0x1D68A, 0x1D7F6, nil},
+}
+
+func (font mathFont) apply(r rune) rune {
+	if styled, ok := font.exceptions[r]; ok {
+		return styled
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return font.upper + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return font.lower + r - 'a'
+	case r >= '0' && r <= '9' && font.digits != 0:
+		return font.digits + r - '0'
+	}
+	return r
+}
+
+// Matrix like environments and their delimiters
+var mathEnvironments = map[string][2]string{
+	"matrix": {"", ""},
+	"smallmatrix": {"", ""},
+	"pmatrix": {"(", ")"},
+	"bmatrix": {"[", "]"},
+	"Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"},
+	"Vmatrix": {"‖", "‖"},
+	"cases": {"{", ""},
+	"aligned": {"", ""},
+	"align": {"", ""},
+	"align*": {"", ""},
+	"gathered": {"", ""},
+	"array": {"", ""},
+}
+
+type mathNode struct {
+	XML string
+	// Scripts are placed above and below in display math
+	Limits bool
+	// Scripts are always placed above and below, e.g. \underbrace
+	AlwaysLimits bool
+}
+
+type texParser struct {
+	src string
+	pos int
+	display bool
+	// Name of the font command currently applied to letters
+	font string
+}
+
+func (p *texParser) errorf(format string, args ...any) error {
+	return &MathError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *texParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos += 1
+	}
+}
+
+// Next token without consuming it, a command like \alpha or \, or a single
+// character
+func (p *texParser) peek() string {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return ""
+	}
+
+	if p.src[p.pos] == '\\' {
+		end := p.pos + 1
+		for end < len(p.src) && isASCIILetter(p.src[end]) {
+			end += 1
+		}
+		if end == p.pos + 1 && end < len(p.src) {
+			_, size := utf8.DecodeRuneInString(p.src[end:])
+			end += size
+		}
+		return p.src[p.pos:end]
+	}
+
+	_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	return p.src[p.pos:p.pos + size]
+}
+
+func (p *texParser) next() string {
+	token := p.peek()
+	p.pos += len(token)
+	return token
+}
+
+func (p *texParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return p.errorf("expected %s, found end of input", token)
+		}
+		return p.errorf("expected %s, found %s", token, got)
+	}
+	return nil
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func mathElement(tag string, attrs string, text string) string {
+	if attrs != "" {
+		attrs = " " + attrs
+	}
+	return "<" + tag + attrs + ">" + template.HTMLEscapeString(text) + "</" + tag + ">"
+}
+
+func mathRow(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+// Parses nodes until a token for which stop returns true, or the end of input
+func (p *texParser) parseRow(stop func(token string) bool) ([]string, error) {
+	nodes := make([]string, 0, 8)
+
+	for {
+		token := p.peek()
+		if token == "" || stop(token) {
+			return nodes, nil
+		}
+
+		switch token {
+		case "}":
+			return nil, p.errorf("unexpected }")
+
+		case "\\displaystyle", "\\textstyle":
+			p.next()
+			rest, err := p.parseRow(stop)
+			if err != nil { return nil, err }
+			display := "true"
+			if token == "\\textstyle" {
+				display = "false"
+			}
+			nodes = append(nodes, `<mstyle displaystyle="` + display + `">` + strings.Join(rest, "") + "</mstyle>")
+			return nodes, nil
+		}
+
+		node, err := p.parseScripted()
+		if err != nil { return nil, err }
+		nodes = append(nodes, node)
+	}
+}
+
+// Parses an atom followed by its subscript, superscript and primes
+func (p *texParser) parseScripted() (string, error) {
+	base, err := p.parseAtom(false)
+	if err != nil { return "", err }
+
+	var sub, sup string
+	primes := ""
+
+	for {
+		switch p.peek() {
+		case "_", "^":
+			token := p.next()
+			if (token == "_" && sub != "") || (token == "^" && sup != "") {
+				return "", p.errorf("double %s", token)
+			}
+			arg, err := p.parseAtom(true)
+			if err != nil { return "", err }
+			if token == "_" {
+				sub = arg.XML
+			} else {
+				sup = arg.XML
+			}
+			continue
+
+		case "'":
+			p.next()
+			primes += "′"
+			continue
+		}
+		break
+	}
+
+	if primes != "" {
+		prime := mathElement("mo", "", primes)
+		if sup == "" {
+			sup = prime
+		} else {
+			sup = "<mrow>" + prime + sup + "</mrow>"
+		}
+	}
+
+	limits := base.AlwaysLimits || (base.Limits && p.display)
+
+	switch {
+	case sub != "" && sup != "" && limits:
+		return "<munderover>" + base.XML + sub + sup + "</munderover>", nil
+	case sub != "" && sup != "":
+		return "<msubsup>" + base.XML + sub + sup + "</msubsup>", nil
+	case sub != "" && limits:
+		return "<munder>" + base.XML + sub + "</munder>", nil
+	case sub != "":
+		return "<msub>" + base.XML + sub + "</msub>", nil
+	case sup != "" && limits:
+		return "<mover>" + base.XML + sup + "</mover>", nil
+	case sup != "":
+		return "<msup>" + base.XML + sup + "</msup>", nil
+	}
+
+	return base.XML, nil
+}
+
+// Parses a {group}, used for arguments of commands
+func (p *texParser) parseGroup() (string, error) {
+	if err := p.expect("{"); err != nil { return "", err }
+
+	nodes, err := p.parseRow(func(token string) bool { return token == "}" })
+	if err != nil { return "", err }
+
+	if err := p.expect("}"); err != nil { return "", err }
+	return mathRow(nodes), nil
+}
+
+// Reads a {group} as plain text, e.g. for \text
+func (p *texParser) parseRawGroup() (string, error) {
+	if err := p.expect("{"); err != nil { return "", err }
+
+	start := p.pos
+	depth := 1
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 1
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+			if depth == 0 {
+				text := p.src[start:p.pos]
+				p.pos += 1
+				return text, nil
+			}
+		}
+	}
+	return "", p.errorf("missing }")
+}
+
+// Parses the delimiter after \left, \right or \big
+func (p *texParser) parseDelimiter(attrs string) (string, error) {
+	token := p.next()
+
+	var text string
+	switch {
+	case token == "":
+		return "", p.errorf("missing delimiter")
+	case token == ".":
+		return "", nil
+	case strings.ContainsAny(token, "()[]|/") && len(token) == 1:
+		text = token
+	case token == "<":
+		text = "⟨"
+	case token == ">":
+		text = "⟩"
+	case strings.HasPrefix(token, "\\") && mathOperators[token[1:]] != "":
+		text = mathOperators[token[1:]]
+	default:
+		return "", p.errorf("invalid delimiter %s", token)
+	}
+
+	return mathElement("mo", attrs, text), nil
+}
+
+func (p *texParser) parseAtom(argument bool) (mathNode, error) {
+	start := p.pos
+	token := p.next()
+
+	switch {
+	case token == "":
+		return mathNode{}, p.errorf("unexpected end of input")
+
+	case token == "{":
+		p.pos = start
+		group, err := p.parseGroup()
+		return mathNode{XML: group}, err
+
+	case token == "}" || token == "&" || token == "_" || token == "^":
+		p.pos = start
+		return mathNode{}, p.errorf("unexpected %s", token)
+
+	case isDigit(token[0]):
+		end := p.pos
+		if !argument && p.font == "" {
+			for end < len(p.src) && (isDigit(p.src[end]) || (p.src[end] == '.' && end + 1 < len(p.src) && isDigit(p.src[end + 1]))) {
+				end += 1
+			}
+		}
+		number := p.src[start:end]
+		p.pos = end
+		if font, ok := mathFonts[p.font]; ok {
+			number = strings.Map(font.apply, number)
+		}
+		return mathNode{XML: mathElement("mn", "", number)}, nil
+
+	case token == "-":
+		return mathNode{XML: mathElement("mo", "", "−")}, nil
+
+	case token == "~":
+		return mathNode{XML: `<mspace width="0.25em"></mspace>`}, nil
+
+	case strings.ContainsAny(token, "()[]|") && len(token) == 1:
+		return mathNode{XML: mathElement("mo", `stretchy="false"`, token)}, nil
+
+	case token[0] == '\\':
+		return p.parseCommand(token[1:])
+	}
+
+	r, _ := utf8.DecodeRuneInString(token)
+	if unicode.IsLetter(r) {
+		switch p.font {
+		case "":
+			return mathNode{XML: mathElement("mi", "", token)}, nil
+		case "mathrm":
+			return mathNode{XML: mathElement("mi", `mathvariant="normal"`, token)}, nil
+		default:
+			return mathNode{XML: mathElement("mi", `mathvariant="normal"`, string(mathFonts[p.font].apply(r)))}, nil
+		}
+	}
+
+	return mathNode{XML: mathElement("mo", "", token)}, nil
+}
+
+func (p *texParser) parseCommand(name string) (mathNode, error) {
+	if text, ok := mathIdentifiers[name]; ok {
+		return mathNode{XML: mathElement("mi", "", text)}, nil
+	}
+	if text, ok := mathUprightIdentifiers[name]; ok {
+		return mathNode{XML: mathElement("mi", `mathvariant="normal"`, text)}, nil
+	}
+	if text, ok := mathOperators[name]; ok {
+		return mathNode{XML: mathElement("mo", "", text)}, nil
+	}
+	if text, ok := mathLargeOperators[name]; ok {
+		return mathNode{XML: mathElement("mo", `largeop="true" movablelimits="false"`, text), Limits: true}, nil
+	}
+	if text, ok := mathIntegrals[name]; ok {
+		return mathNode{XML: mathElement("mo", `largeop="true"`, text)}, nil
+	}
+	if mathFunctions[name] {
+		return mathNode{XML: mathElement("mi", "", name)}, nil
+	}
+	if mathLimitFunctions[name] {
+		return mathNode{XML: mathElement("mi", "", name), Limits: true}, nil
+	}
+	if width, ok := mathSpaces[name]; ok {
+		return mathNode{XML: `<mspace width="` + width + `"></mspace>`}, nil
+	}
+
+	if accent, ok := mathAccents[name]; ok {
+		arg, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+		stretchy := "false"
+		if strings.HasPrefix(name, "wide") || name == "overline" || name == "overrightarrow" {
+			stretchy = "true"
+		}
+		return mathNode{XML: `<mover accent="true">` + arg.XML + mathElement("mo", `stretchy="` + stretchy + `"`, accent) + "</mover>"}, nil
+	}
+
+	if _, ok := mathFonts[name]; ok || name == "mathrm" {
+		font := p.font
+		p.font = name
+		arg, err := p.parseAtom(true)
+		p.font = font
+		return arg, err
+	}
+
+	if size, ok := mathDelimiterSizes[strings.TrimRight(name, "lrm")]; ok {
+		delimiter, err := p.parseDelimiter(`minsize="` + size + `" maxsize="` + size + `"`)
+		return mathNode{XML: delimiter}, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "binom":
+		numerator, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+		denominator, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+
+		if name == "binom" {
+			return mathNode{XML: `<mrow><mo>(</mo><mfrac linethickness="0">` + numerator.XML + denominator.XML + `</mfrac><mo>)</mo></mrow>`}, nil
+		}
+		frac := "<mfrac>" + numerator.XML + denominator.XML + "</mfrac>"
+		if name == "dfrac" {
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		} else if name == "tfrac" {
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return mathNode{XML: frac}, nil
+
+	case "sqrt":
+		if p.peek() == "[" {
+			p.next()
+			index, err := p.parseRow(func(token string) bool { return token == "]" })
+			if err != nil { return mathNode{}, err }
+			if err := p.expect("]"); err != nil { return mathNode{}, err }
+
+			radicand, err := p.parseAtom(true)
+			if err != nil { return mathNode{}, err }
+			return mathNode{XML: "<mroot>" + radicand.XML + mathRow(index) + "</mroot>"}, nil
+		}
+		radicand, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+		return mathNode{XML: "<msqrt>" + radicand.XML + "</msqrt>"}, nil
+
+	case "text", "textrm", "mbox":
+		text, err := p.parseRawGroup()
+		return mathNode{XML: mathElement("mtext", "", text)}, err
+
+	case "operatorname":
+		limits := p.peek() == "*"
+		if limits {
+			p.next()
+		}
+		text, err := p.parseRawGroup()
+		return mathNode{XML: mathElement("mi", "", text), Limits: limits}, err
+
+	case "overbrace", "underbrace":
+		arg, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+		if name == "overbrace" {
+			return mathNode{XML: "<mover>" + arg.XML + mathElement("mo", `stretchy="true"`, "⏞") + "</mover>", AlwaysLimits: true}, nil
+		}
+		return mathNode{XML: "<munder>" + arg.XML + mathElement("mo", `stretchy="true"`, "⏟") + "</munder>", AlwaysLimits: true}, nil
+
+	case "not":
+		arg, err := p.parseAtom(true)
+		if err != nil { return mathNode{}, err }
+		switch arg.XML {
+		case "<mo>=</mo>":
+			return mathNode{XML: "<mo>≠</mo>"}, nil
+		case "<mo>∈</mo>":
+			return mathNode{XML: "<mo>∉</mo>"}, nil
+		}
+		if !strings.HasPrefix(arg.XML, "<mo>") {
+			return mathNode{}, p.errorf("\\not must be followed by an operator")
+		}
+		// Overlaid with a combining long solidus
+		return mathNode{XML: strings.TrimSuffix(arg.XML, "</mo>") + "\u0338</mo>"}, nil
+
+	case "left":
+		open, err := p.parseDelimiter(`fence="true" stretchy="true"`)
+		if err != nil { return mathNode{}, err }
+
+		nodes, err := p.parseRow(func(token string) bool { return token == "\\right" })
+		if err != nil { return mathNode{}, err }
+		if err := p.expect("\\right"); err != nil { return mathNode{}, err }
+
+		close, err := p.parseDelimiter(`fence="true" stretchy="true"`)
+		if err != nil { return mathNode{}, err }
+		return mathNode{XML: "<mrow>" + open + strings.Join(nodes, "") + close + "</mrow>"}, nil
+
+	case "begin":
+		return p.parseEnvironment()
+	}
+
+	return mathNode{}, p.errorf("unknown command \\%s", name)
+}
+
+func (p *texParser) parseEnvironment() (mathNode, error) {
+	name, err := p.parseRawGroup()
+	if err != nil { return mathNode{}, err }
+
+	fences, ok := mathEnvironments[name]
+	if !ok {
+		return mathNode{}, p.errorf("unknown environment %s", name)
+	}
+
+	// Column alignment of arrays, e.g. {lcr}
+	align := []string{}
+	if name == "array" {
+		spec, err := p.parseRawGroup()
+		if err != nil { return mathNode{}, err }
+		for _, c := range spec {
+			switch c {
+			case 'l':
+				align = append(align, "left")
+			case 'c':
+				align = append(align, "center")
+			case 'r':
+				align = append(align, "right")
+			}
+		}
+	}
+	switch name {
+	case "cases":
+		align = []string{"left", "left"}
+	case "aligned", "align", "align*":
+		align = []string{"right", "left"}
+	}
+
+	stop := func(token string) bool {
+		return token == "&" || token == "\\\\" || token == "\\end"
+	}
+
+	rows := make([]string, 0, 4)
+	cells := make([]string, 0, 4)
+
+	for {
+		nodes, err := p.parseRow(stop)
+		if err != nil { return mathNode{}, err }
+
+		cell := "<mtd>"
+		if len(align) > 0 {
+			cell = `<mtd style="text-align: ` + align[len(cells) % len(align)] + `">`
+		}
+		cells = append(cells, cell + strings.Join(nodes, "") + "</mtd>")
+
+		token := p.next()
+		if token == "&" {
+			continue
+		}
+		rows = append(rows, "<mtr>" + strings.Join(cells, "") + "</mtr>")
+		cells = cells[:0]
+
+		if token == "\\end" {
+			break
+		}
+		if token == "" {
+			return mathNode{}, p.errorf("missing \\end{%s}", name)
+		}
+	}
+
+	end, err := p.parseRawGroup()
+	if err != nil { return mathNode{}, err }
+	if end != name {
+		return mathNode{}, p.errorf("\\begin{%s} ended by \\end{%s}", name, end)
+	}
+
+	table := "<mtable>" + strings.Join(rows, "") + "</mtable>"
+	if fences[0] != "" || fences[1] != "" {
+		open, close := "", ""
+		if fences[0] != "" {
+			open = mathElement("mo", `fence="true"`, fences[0])
+		}
+		if fences[1] != "" {
+			close = mathElement("mo", `fence="true"`, fences[1])
+		}
+		table = "<mrow>" + open + table + close + "</mrow>"
+	}
+	return mathNode{XML: table}, nil
+}
+
+func TexToMathML(tex string, display bool) (string, error) {
+	p := &texParser{src: tex, display: display}
+
+	nodes, err := p.parseRow(func(token string) bool { return false })
+	if err != nil { return "", err }
+
+	attrs := ""
+	if display {
+		attrs = ` display="block"`
+	}
+
+	return "<math" + attrs + "><semantics>" + mathRow(nodes) +
+		`<annotation encoding="application/x-tex">` + template.HTMLEscapeString(tex) + "</annotation>" +
+		"</semantics></math>", nil
+}
+
+// Parses inline $...$ by the rules of pandoc, so that prices like "$5 and
+// $10" stay text: the opening $ must not be followed by whitespace, the next
+// $ closes it and must neither follow whitespace nor be followed by a digit.
+func parseInlineMath(p *parser.Parser, data []byte, offset int) (int, ast.Node) {
+	data = data[offset:]
+
+	// $$ starts block math
+	if len(data) < 3 || data[1] == '$' || isMathSpace(data[1]) {
+		return 0, nil
+	}
+
+	for end := 2; end < len(data); end++ {
+		switch data[end] {
+		case '\\':
+			end += 1
+		case '$':
+			if isMathSpace(data[end - 1]) || (end + 1 < len(data) && isDigit(data[end + 1])) {
+				return 0, nil
+			}
+			math := &ast.Math{}
+			math.Literal = data[1:end]
+			return end + 1, math
+		}
+	}
+	return 0, nil
+}
+
+func isMathSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// Renders $...$ and $$...$$, expressions that fail to parse are shown as
+// source with the error in a tooltip
+func renderMath(w io.Writer, tex string, display bool) (ast.WalkStatus, bool) {
+	mathML, err := TexToMathML(strings.TrimSpace(tex), display)
+
+	if err != nil {
+		tag, delim := "span", "$"
+		if display {
+			tag, delim = "div", "$$"
+		}
+		io.WriteString(w, "<" + tag + ` class="math-error" title="` + template.HTMLEscapeString("Math error: " + err.Error()) + `">`)
+		io.WriteString(w, template.HTMLEscapeString(delim + tex + delim))
+		io.WriteString(w, "</" + tag + ">")
+		return ast.GoToNext, true
+	}
+
+	if display {
+		io.WriteString(w, "\n" + mathML + "\n")
+	} else {
+		io.WriteString(w, mathML)
+	}
+	return ast.GoToNext, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineMathDelimiters(t *testing.T) {
+	tests := []struct {
+		source string
+		// Literal of every math node, in order
+		want []string
+	}{
+		{"It costs $5 and $10 today.", nil},
+		{"Between $5 and $10.", nil},
+		{"From $5 to $ 10.", nil},
+		{"A $ x$ is not math.", nil},
+		{"Neither is $x $.", nil},
+		{"Closing before a digit $x$5 is skipped.", nil},
+		{"Unterminated $x", nil},
+		{"Escaped \\$x$ dollar", nil},
+		{"Inline $x$ math", []string{"x"}},
+		{"Sum $a + b$.", []string{"a + b"}},
+		{"Two $a$ and $b$", []string{"a", "b"}},
+		{"A digit inside $x^2$ works", []string{"x^2"}},
+		{"Escaped dollar inside $a\\$b$", []string{"a\\$b"}},
+		{"No closing later $a $b$ text", []string{"b"}},
+		{"Price $5 and math $x$", []string{"x"}},
+		{"It costs $5 and $10 today. Euler $e^{i\\pi} = -1$.", []string{"e^{i\\pi} = -1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("math", test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(test.want))
+			content := string(article.Content)
+			for {
+				start := strings.Index(content, `<annotation encoding="application/x-tex">`)
+				if start < 0 {
+					break
+				}
+				content = content[start + len(`<annotation encoding="application/x-tex">`):]
+				end := strings.Index(content, "</annotation>")
+				got = append(got, content[:end])
+			}
+
+			if strings.Join(got, "|") != strings.Join(test.want, "|") || len(got) != len(test.want) {
+				t.Errorf("math %q, want %q in %s", got, test.want, article.Content)
+			}
+		})
+	}
+}
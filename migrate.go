@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"embed"
+	"strconv"
+	"strings"
+	"path"
+	"slices"
+)
+
+// Schema changes are numbered SQL files, applied in order and recorded in the
+// schema_version table. Applied migrations must never be edited, add a new one.
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name string
+	SQL string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	AppliedAt time.Time
+}
+
+func LoadMigrations() ([]Migration, error){
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil { return nil, err }
+
+	migrations := make([]Migration, 0, len(entries))
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, label, _ := strings.Cut(name, "_")
+
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %q does not start with a version number", entry.Name())
+		}
+
+		source, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil { return nil, err }
+
+		migrations = append(migrations, Migration{Version: version, Name: label, SQL: string(source)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i - 1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Databases from before migrations existed were created from schema.sql, which
+// grew along with the first migrations. Each of those is recognized by the
+// tables and columns it added.
+var schemaMarkers = []struct {
+	version int
+	table string
+	columns []string
+}{
+	{1, "Article", []string{"Id", "Name", "Title", "RawTitle", "Content", "CreatedAt", "UpdatedAt"}},
+	{2, "Article", []string{"Description", "Author", "Tags", "PublishedAt", "Draft", "Extra"}},
+	{3, "Tag", []string{"Id", "Name"}},
+	{3, "ArticleTag", []string{"ArticleId", "TagId"}},
+	{4, "Article", []string{"Hash"}},
+	{5, "Article", []string{"Text"}},
+	{6, "Article", []string{"Source", "Deleted"}},
+	{7, "ArticleRevision", []string{"Id", "ArticleId", "Markdown", "Content", "Hash", "CreatedAt"}},
+}
+
+func (repo *Repository) hasSchemaVersion() (bool, error) {
+	var exists int
+	err := repo.db.Get(&exists, `
+		SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'
+	`)
+	return exists > 0, err
+}
+
+// Finds the migrations a database without schema_version already has. Fails
+// when its schema is only partly one of the known versions, migrating it
+// could then lose data.
+func (repo *Repository) detectSchemaVersion() (int, error) {
+	version := 0
+
+	for _, marker := range schemaMarkers {
+		columns := make([]string, 0, 16)
+		err := repo.db.Select(&columns, `SELECT name FROM pragma_table_info(?)`, marker.table)
+		if err != nil { return 0, err }
+
+		found := 0
+		for _, column := range marker.columns {
+			if slices.Contains(columns, column) {
+				found += 1
+			}
+		}
+
+		switch {
+		case found == 0:
+			continue
+		case found < len(marker.columns):
+			return 0, fmt.Errorf("unrecognized database schema: %s has %d of the %d columns of migration %04d", marker.table, found, len(marker.columns), marker.version)
+		case version < marker.version - 1:
+			return 0, fmt.Errorf("unrecognized database schema: has the %s columns of migration %04d but not those of migration %04d", marker.table, marker.version, version + 1)
+		}
+		version = marker.version
+	}
+
+	return version, nil
+}
+
+// Creates schema_version, recording the migrations a database from before
+// migrations existed already has
+func (repo *Repository) initSchemaVersion() error {
+	exists, err := repo.hasSchemaVersion()
+	if err != nil || exists { return err }
+
+	version, err := repo.detectSchemaVersion()
+	if err != nil { return err }
+
+	migrations, err := LoadMigrations()
+	if err != nil { return err }
+
+	tx, err := repo.db.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		create table schema_version(
+			 Version integer primary key
+			,Name text not null
+			,AppliedAt datetime not null
+		)
+	`)
+	if err != nil { return err }
+
+	for _, migration := range migrations {
+		if migration.Version > version {
+			break
+		}
+		log.Printf("Adopt migration %04d_%s", migration.Version, migration.Name)
+		_, err = tx.Exec(`
+			INSERT INTO schema_version(Version, Name, AppliedAt) VALUES (?, ?, ?)
+		`, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil { return err }
+	}
+
+	return tx.Commit()
+}
+
+// Lists every migration and whether it is applied without writing to the
+// database. Migrations a database from before migrations existed already has
+// are applied with a zero AppliedAt.
+func (repo *Repository) MigrationStatus() ([]MigrationStatus, error){
+	migrations, err := LoadMigrations()
+	if err != nil { return nil, err }
+
+	exists, err := repo.hasSchemaVersion()
+	if err != nil { return nil, err }
+
+	applied := make([]MigrationStatus, 0, len(migrations))
+	if exists {
+		err = repo.db.Select(&applied, `
+			SELECT Version, Name, AppliedAt FROM schema_version
+		`)
+		if err != nil { return nil, err }
+	} else {
+		version, err := repo.detectSchemaVersion()
+		if err != nil { return nil, err }
+		for v := 1; v <= version; v++ {
+			applied = append(applied, MigrationStatus{Migration: Migration{Version: v}})
+		}
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		entry := MigrationStatus{Migration: migration}
+		for _, row := range applied {
+			if row.Version == migration.Version {
+				entry.Applied = true
+				entry.AppliedAt = row.AppliedAt
+			}
+		}
+		status = append(status, entry)
+	}
+
+	return status, nil
+}
+
+// Applies pending migrations, each in its own transaction
+func (repo *Repository) Migrate() ([]Migration, error){
+	err := repo.initSchemaVersion()
+	if err != nil { return nil, err }
+
+	status, err := repo.MigrationStatus()
+	if err != nil { return nil, err }
+
+	applied := make([]Migration, 0, len(status))
+
+	for _, entry := range status {
+		if entry.Applied {
+			continue
+		}
+		migration := entry.Migration
+		log.Printf("Apply migration %04d_%s", migration.Version, migration.Name)
+
+		tx, err := repo.db.Beginx()
+		if err != nil { return applied, err }
+
+		_, err = tx.Exec(migration.SQL)
+		if err == nil {
+			_, err = tx.Exec(`
+				INSERT INTO schema_version(Version, Name, AppliedAt) VALUES (?, ?, ?)
+			`, migration.Version, migration.Name, time.Now().UTC())
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
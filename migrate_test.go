@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"path/filepath"
+)
+
+// Opens a copy of the blog.db checked into the repository, which has the
+// schema from before migrations existed and one article
+func openBaselineRepository(t *testing.T) *Repository {
+	t.Helper()
+	data, err := os.ReadFile("blog.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "blog.db")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return openTestRepository(t, path)
+}
+
+// Opens a database without migrating it
+func openTestRepository(t *testing.T, path string) *Repository {
+	t.Helper()
+	repo, err := OpenRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+// Creates a database the way schema.sql did while it grew along with the
+// first migrations, i.e. with migrations up to version but no schema_version
+func openUnversionedRepository(t *testing.T, version int, extraSQL string) *Repository {
+	t.Helper()
+	repo := openTestRepository(t, filepath.Join(t.TempDir(), "blog.db"))
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations[:version] {
+		if _, err := repo.db.Exec(migration.SQL); err != nil {
+			t.Fatalf("migration %d: %v", migration.Version, err)
+		}
+	}
+	if _, err := repo.db.Exec(extraSQL); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func appliedVersions(migrations []Migration) []int {
+	versions := make([]int, 0, len(migrations))
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	repo := openBaselineRepository(t)
+
+	// Reading the status must not create schema_version
+	status, err := repo.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range status {
+		if entry.Applied != (entry.Version == 1) {
+			t.Errorf("migration %d applied %v", entry.Version, entry.Applied)
+		}
+	}
+	if exists, err := repo.hasSchemaVersion(); err != nil || exists {
+		t.Fatalf("status created schema_version (%v)", err)
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := repo.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) - 1 || applied[0].Version != 2 {
+		t.Errorf("applied %v, want every migration after 1", appliedVersions(applied))
+	}
+
+	var adopted []int
+	err = repo.db.Select(&adopted, `SELECT Version FROM schema_version ORDER BY Version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adopted) != len(migrations) || adopted[0] != 1 {
+		t.Errorf("schema_version %v, want every migration", adopted)
+	}
+
+	articles, err := repo.ListArticles(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 {
+		t.Errorf("%d articles after migrating, want the 1 of blog.db", len(articles))
+	}
+
+	applied, err = repo.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migrate applied %v (%v)", appliedVersions(applied), err)
+	}
+}
+
+func TestMigrateAdoption(t *testing.T) {
+	tests := []struct {
+		name string
+		version int
+		// Run after the migrations up to version
+		extraSQL string
+		wantErr bool
+	}{
+		{name: "empty database", version: 0},
+		{name: "front matter", version: 2},
+		{name: "tags", version: 3},
+		{name: "hash", version: 4},
+		{name: "text", version: 5},
+		{name: "source", version: 6},
+		{name: "revisions", version: 7},
+		{
+			name: "part of front matter",
+			version: 1,
+			extraSQL: "alter table Article add column Description text not null default ''",
+			wantErr: true,
+		},
+		{
+			name: "tags without front matter",
+			version: 1,
+			extraSQL: "create table Tag(Id integer primary key, Name text unique not null)",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := openUnversionedRepository(t, test.version, test.extraSQL)
+
+			applied, err := repo.Migrate()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for an unrecognized schema")
+				}
+				if exists, _ := repo.hasSchemaVersion(); exists {
+					t.Error("schema_version created for an unrecognized schema")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(applied) > 0 && applied[0].Version != test.version + 1 {
+				t.Errorf("applied %v, want to start at %d", appliedVersions(applied), test.version + 1)
+			}
+
+			status, err := repo.MigrationStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range status {
+				if !entry.Applied {
+					t.Errorf("migration %d not applied", entry.Version)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+alter table Article add column Description text not null default '';
+alter table Article add column Author text not null default '';
+alter table Article add column Tags text not null default '[]';
+alter table Article add column PublishedAt datetime not null default '0001-01-01 00:00:00+00:00';
+alter table Article add column Draft boolean not null default 0;
+alter table Article add column Extra text not null default '{}';
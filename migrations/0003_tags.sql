@@ -0,0 +1,10 @@
+create table if not exists Tag(
+	 Id integer primary key
+	,Name text unique not null
+);
+
+create table if not exists ArticleTag(
+	 ArticleId integer not null references Article(Id) on delete cascade
+	,TagId integer not null references Tag(Id) on delete cascade
+	,primary key (ArticleId, TagId)
+);
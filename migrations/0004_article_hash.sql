@@ -0,0 +1 @@
+alter table Article add column Hash text not null default '';
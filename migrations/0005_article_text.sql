@@ -0,0 +1 @@
+alter table Article add column Text text not null default '';
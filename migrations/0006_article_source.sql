@@ -0,0 +1,2 @@
+alter table Article add column Source text not null default '';
+alter table Article add column Deleted boolean not null default 0;
@@ -0,0 +1,10 @@
+create table if not exists ArticleRevision(
+	 Id integer primary key
+	,ArticleId integer not null references Article(Id) on delete cascade
+	,Markdown text not null
+	,Content text not null
+	,Hash text not null
+	,CreatedAt datetime not null
+);
+
+create index if not exists ArticleRevisionByArticle on ArticleRevision(ArticleId, Id);
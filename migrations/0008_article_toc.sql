@@ -0,0 +1 @@
+alter table Article add column TOC text not null default '{}';
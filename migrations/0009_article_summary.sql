@@ -0,0 +1 @@
+alter table Article add column Summary text not null default '';
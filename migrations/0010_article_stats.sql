@@ -0,0 +1,4 @@
+alter table Article add column WordCount integer not null default 0;
+alter table Article add column ReadingMinutes integer not null default 0;
+alter table Article add column CodeBlocks integer not null default 0;
+alter table Article add column Images integer not null default 0;
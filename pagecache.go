@@ -0,0 +1,264 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+	"bytes"
+	"strconv"
+	"strings"
+	"net/http"
+	"sync/atomic"
+	"compress/gzip"
+	"container/list"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Least recently used cache of rendered pages keyed by path. Pages are kept
+// with brotli and gzip copies so hits skip the database, templates and
+// compression.
+type PageCache struct {
+	mutex sync.Mutex
+	capacity int
+	pages map[string]*list.Element
+	order *list.List
+	// Bumped on invalidation, pages rendered before it are not stored
+	generation uint64
+	// When the cached pages go stale on their own, e.g. once a scheduled
+	// article gets published
+	expires time.Time
+	nextChange func() time.Time
+
+	hits atomic.Int64
+	misses atomic.Int64
+}
+
+type cachedPage struct {
+	key string
+	header http.Header
+	body []byte
+	gzip []byte
+	brotli []byte
+}
+
+// A capacity of 0 or less disables the cache, nextChange returns when pages
+// change without a sync or the zero time
+func NewPageCache(capacity int, nextChange func() time.Time) *PageCache {
+	if capacity <= 0 {
+		return nil
+	}
+
+	cache := &PageCache{
+		capacity: capacity,
+		pages: make(map[string]*list.Element),
+		order: list.New(),
+		nextChange: nextChange,
+	}
+	cache.expires = nextChange()
+	return cache
+}
+
+func (cache *PageCache) get(key string) (*cachedPage, uint64) {
+	cache.mutex.Lock()
+	expired := !cache.expires.IsZero() && time.Now().After(cache.expires)
+	cache.mutex.Unlock()
+
+	if expired {
+		cache.Invalidate()
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	elem, ok := cache.pages[key]
+	if !ok {
+		return nil, cache.generation
+	}
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*cachedPage), cache.generation
+}
+
+func (cache *PageCache) put(page *cachedPage, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	if elem, ok := cache.pages[page.key]; ok {
+		elem.Value = page
+		cache.order.MoveToFront(elem)
+		return
+	}
+
+	cache.pages[page.key] = cache.order.PushFront(page)
+	for cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.pages, oldest.Value.(*cachedPage).key)
+	}
+}
+
+// Drops every page, called whenever articles or templates change
+func (cache *PageCache) Invalidate() {
+	if cache == nil {
+		return
+	}
+
+	expires := cache.nextChange()
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.pages = make(map[string]*list.Element)
+	cache.order.Init()
+	cache.generation += 1
+	cache.expires = expires
+}
+
+func (cache *PageCache) Stats() (hits int64, misses int64) {
+	if cache == nil {
+		return 0, 0
+	}
+	return cache.hits.Load(), cache.misses.Load()
+}
+
+func (cache *PageCache) LogStats() {
+	hits, misses := cache.Stats()
+	log.Printf("Page cache: %d hits, %d misses", hits, misses)
+}
+
+// Whether the client accepts a content coding, e.g. "br" or "gzip"
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) == coding && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	if err != nil { return nil, err }
+	err = zw.Close()
+	return buf.Bytes(), err
+}
+
+// Pages are compressed on every cache miss, so they use a faster level than
+// static assets which are compressed once
+func brotliBytes(data []byte, level int) ([]byte, error) {
+	buf := bytes.Buffer{}
+	bw := brotli.NewWriterLevel(&buf, level)
+	_, err := bw.Write(data)
+	if err != nil { return nil, err }
+	err = bw.Close()
+	return buf.Bytes(), err
+}
+
+// Writes a cached page, answering conditional requests with a 304
+func (cache *PageCache) serve(w http.ResponseWriter, r *http.Request, page *cachedPage, precompressed bool) {
+	header := w.Header()
+	for name, values := range page.header {
+		header[name] = values
+	}
+
+	body, etag := page.body, page.header.Get("ETag")
+	if precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		// Brotli is preferred, it is smaller than gzip for text
+		switch {
+		case acceptsEncoding(r, "br"):
+			header.Set("Content-Encoding", "br")
+			body, etag = page.brotli, encodedETag(etag, "br")
+		case acceptsEncoding(r, "gzip"):
+			header.Set("Content-Encoding", "gzip")
+			body, etag = page.gzip, encodedETag(etag, "gzip")
+		}
+	}
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+
+	modified, _ := http.ParseTime(page.header.Get("Last-Modified"))
+	if isNotModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// Serves pages from the cache, rendering and storing them on a miss. Only
+// successful responses to requests without a query are cached. Without
+// precompressed pages are always sent uncompressed, for middleware that has
+// to change the body.
+func (cache *PageCache) Middleware(precompressed bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if cache == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if r.URL.RawQuery != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.URL.Path
+			page, generation := cache.get(key)
+			if page != nil {
+				cache.hits.Add(1)
+				w.Header().Set("X-Cache", "HIT")
+				cache.serve(w, r, page, precompressed)
+				return
+			}
+			cache.misses.Add(1)
+			w.Header().Set("X-Cache", "MISS")
+
+			// Render the whole page even for conditional requests so it can
+			// be stored
+			full := r.Clone(r.Context())
+			full.Header.Del("If-None-Match")
+			full.Header.Del("If-Modified-Since")
+
+			res := &bufferedResponse{ResponseWriter: w, status: 200}
+			next.ServeHTTP(res, full)
+
+			if res.status != http.StatusOK || w.Header().Get("Cache-Control") == "no-store" {
+				w.WriteHeader(res.status)
+				w.Write(res.buf.Bytes())
+				return
+			}
+
+			page = &cachedPage{
+				key: key,
+				header: w.Header().Clone(),
+				body: res.buf.Bytes(),
+			}
+			page.header.Del("X-Cache")
+
+			if precompressed {
+				var err error
+				page.gzip, err = gzipBytes(page.body)
+				if err == nil {
+					page.brotli, err = brotliBytes(page.body, brotli.DefaultCompression)
+				}
+				if err != nil {
+					log.Println("Failed to compress page:", err.Error())
+					w.Write(page.body)
+					return
+				}
+			}
+
+			cache.put(page, generation)
+			cache.serve(w, r, page, precompressed)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"io"
+	"time"
+	"bytes"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"compress/gzip"
+
+	"github.com/andybalholm/brotli"
+)
+
+const testPageBody = "<p>A page that is long enough to be worth compressing, compressing, compressing.</p>"
+
+// Cached handler counting how often pages get rendered
+func newTestPageCache(capacity int, nextChange func() time.Time) (*PageCache, http.Handler, map[string]int) {
+	if nextChange == nil {
+		nextChange = func() time.Time { return time.Time{} }
+	}
+	cache := NewPageCache(capacity, nextChange)
+	renders := make(map[string]int)
+
+	handler := cache.Middleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		renders[r.URL.Path] += 1
+		switch r.URL.Path {
+		case "/missing":
+			httpError(w, 404)
+			return
+		case "/private":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 04 Mar 2024 10:00:00 GMT")
+		io.WriteString(w, testPageBody)
+	}))
+	return cache, handler, renders
+}
+
+func requestPage(handler http.Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestPageCacheEviction(t *testing.T) {
+	_, handler, renders := newTestPageCache(2, nil)
+
+	steps := []struct {
+		path string
+		cache string
+	}{
+		{"/a", "MISS"},
+		{"/b", "MISS"},
+		{"/a", "HIT"},
+		// Evicts /b, the least recently used
+		{"/c", "MISS"},
+		{"/a", "HIT"},
+		{"/b", "MISS"},
+		// Evicted by /b
+		{"/c", "MISS"},
+		{"/a?page=2", ""},
+		{"/missing", "MISS"},
+		{"/missing", "MISS"},
+		{"/private", "MISS"},
+		{"/private", "MISS"},
+	}
+
+	for i, step := range steps {
+		rec := requestPage(handler, step.path, nil)
+		if got := rec.Header().Get("X-Cache"); got != step.cache {
+			t.Errorf("step %d %s: X-Cache %q, want %q", i, step.path, got, step.cache)
+		}
+	}
+
+	want := map[string]int{"/a": 2, "/b": 2, "/c": 2, "/missing": 2, "/private": 2}
+	for path, count := range want {
+		if renders[path] != count {
+			t.Errorf("%s rendered %d times, want %d", path, renders[path], count)
+		}
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case "br":
+		r = brotli.NewReader(r)
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPageCacheNegotiation(t *testing.T) {
+	tests := []struct {
+		name string
+		acceptEncoding string
+		ifNoneMatch string
+		status int
+		encoding string
+		etag string
+	}{
+		{"identity", "", "", 200, "", `"v1"`},
+		{"brotli", "gzip, deflate, br", "", 200, "br", `"v1-br"`},
+		{"gzip", "gzip", "", 200, "gzip", `"v1-gzip"`},
+		{"brotli refused", "br;q=0, gzip", "", 200, "gzip", `"v1-gzip"`},
+		{"identity revalidated", "", `"v1"`, 304, "", `"v1"`},
+		{"brotli revalidated", "br", `"v1-br"`, 304, "br", `"v1-br"`},
+		{"gzip revalidated", "gzip", `"v1-gzip"`, 304, "gzip", `"v1-gzip"`},
+		{"validator of another encoding", "br", `"v1-gzip"`, 200, "br", `"v1-br"`},
+		{"identity validator with brotli", "br", `"v1"`, 200, "br", `"v1-br"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, handler, _ := newTestPageCache(4, nil)
+
+			// On a miss and on a hit
+			for _, cache := range []string{"MISS", "HIT"} {
+				rec := requestPage(handler, "/", map[string]string{
+					"Accept-Encoding": test.acceptEncoding,
+					"If-None-Match": test.ifNoneMatch,
+				})
+				header := rec.Header()
+
+				if header.Get("X-Cache") != cache {
+					t.Fatalf("X-Cache %q, want %q", header.Get("X-Cache"), cache)
+				}
+				if rec.Code != test.status {
+					t.Errorf("%s: status %d, want %d", cache, rec.Code, test.status)
+				}
+				if got := header.Get("Content-Encoding"); got != test.encoding {
+					t.Errorf("%s: encoding %q, want %q", cache, got, test.encoding)
+				}
+				if got := header.Get("ETag"); got != test.etag {
+					t.Errorf("%s: ETag %s, want %s", cache, got, test.etag)
+				}
+				if got := header.Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+					t.Errorf("%s: Vary %q, want Accept-Encoding once", cache, got)
+				}
+				if rec.Code == 200 {
+					if body := decodeBody(t, test.encoding, rec.Body.Bytes()); body != testPageBody {
+						t.Errorf("%s: body %q", cache, body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPageCacheInvalidation(t *testing.T) {
+	cache, handler, renders := newTestPageCache(4, nil)
+
+	requestPage(handler, "/a", nil)
+	cache.Invalidate()
+	if got := requestPage(handler, "/a", nil).Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("after invalidation X-Cache %q, want MISS", got)
+	}
+
+	// A page rendered while the cache is invalidated is not stored
+	page, generation := cache.get("/b")
+	if page != nil {
+		t.Fatal("unexpected page")
+	}
+	cache.Invalidate()
+	cache.put(&cachedPage{key: "/b", header: http.Header{}}, generation)
+	if page, _ := cache.get("/b"); page != nil {
+		t.Error("page of an older generation was stored")
+	}
+
+	if renders["/a"] != 2 {
+		t.Errorf("rendered %d times, want 2", renders["/a"])
+	}
+
+	hits, misses := cache.Stats()
+	if hits != 0 || misses != 2 {
+		t.Errorf("%d hits and %d misses, want 0 and 2", hits, misses)
+	}
+}
+
+func TestPageCacheExpiry(t *testing.T) {
+	// A scheduled article is due in an hour
+	scheduled := time.Now().Add(time.Hour)
+	cache, handler, renders := newTestPageCache(4, func() time.Time { return scheduled })
+
+	steps := []struct {
+		// Moves the clock past the scheduled article
+		publish bool
+		cache string
+		renders int
+	}{
+		{false, "MISS", 1},
+		{false, "HIT", 1},
+		{true, "MISS", 2},
+		// Nothing else is scheduled
+		{false, "HIT", 2},
+	}
+
+	for i, step := range steps {
+		if step.publish {
+			cache.mutex.Lock()
+			cache.expires = time.Now().Add(-time.Second)
+			cache.mutex.Unlock()
+			scheduled = time.Time{}
+		}
+
+		rec := requestPage(handler, "/", nil)
+		if got := rec.Header().Get("X-Cache"); got != step.cache {
+			t.Errorf("step %d: X-Cache %q, want %q", i, got, step.cache)
+		}
+		if renders["/"] != step.renders {
+			t.Errorf("step %d: rendered %d times, want %d", i, renders["/"], step.renders)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+	"strconv"
+	"net/http"
+)
+
+const reloadPath = "/_reload"
+
+const reloadScript = `<script>new EventSource("` + reloadPath + `").addEventListener("reload", () => location.reload())</script>`
+
+// Pushes reload events to open pages over Server-Sent Events
+type ReloadBroker struct {
+	mutex sync.Mutex
+	clients map[chan struct{}]struct{}
+	// Closed on shutdown, ends every event stream
+	done chan struct{}
+	closeOnce sync.Once
+}
+
+func NewReloadBroker() *ReloadBroker {
+	return &ReloadBroker{
+		clients: make(map[chan struct{}]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Ends the open event streams, which would otherwise keep a graceful shutdown
+// waiting
+func (broker *ReloadBroker) Close() {
+	broker.closeOnce.Do(func(){
+		close(broker.done)
+	})
+}
+
+func (broker *ReloadBroker) Notify() {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for client := range broker.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (broker *ReloadBroker) subscribe() chan struct{} {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	client := make(chan struct{}, 1)
+	broker.clients[client] = struct{}{}
+	return client
+}
+
+func (broker *ReloadBroker) unsubscribe(client chan struct{}) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	delete(broker.clients, client)
+}
+
+func (broker *ReloadBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, 500)
+		return
+	}
+
+	// The stream outlives the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	client := broker.subscribe()
+	defer broker.unsubscribe(client)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-broker.done:
+			return
+		case <-keepAlive.C:
+			w.Write([]byte(": ping\n\n"))
+		case <-client:
+			w.Write([]byte("event: reload\ndata: \n\n"))
+		}
+		flusher.Flush()
+	}
+}
+
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	buf bytes.Buffer
+}
+
+func (res *bufferedResponse) WriteHeader(status int) {
+	res.status = status
+}
+
+func (res *bufferedResponse) Write(data []byte) (int, error) {
+	return res.buf.Write(data)
+}
+
+// Adds the reload script to every HTML page
+func (broker *ReloadBroker) InjectScript(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		if r.URL.Path == reloadPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := &bufferedResponse{ResponseWriter: w, status: 200}
+		next.ServeHTTP(res, r)
+
+		body := res.buf.Bytes()
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+
+		if bytes.HasPrefix([]byte(contentType), []byte("text/html")) {
+			if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+				body = append(body[:i:i], append([]byte(reloadScript), body[i:]...)...)
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Header().Del("ETag")
+			}
+		}
+
+		w.WriteHeader(res.status)
+		w.Write(body)
+	})
+}
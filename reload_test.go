@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"time"
+	"bufio"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestInjectScript(t *testing.T) {
+	tests := []struct {
+		name string
+		contentType string
+		body string
+		want string
+	}{
+		{"html page", "text/html; charset=utf-8", "<html><body><p>Hi</p></body></html>", "<html><body><p>Hi</p>" + reloadScript + "</body></html>"},
+		{"sniffed html", "", "<!DOCTYPE html><body></body>", "<!DOCTYPE html><body>" + reloadScript + "</body>"},
+		{"last body tag", "text/html", "<body><code></body></code></body>", "<body><code></body></code>" + reloadScript + "</body>"},
+		{"html fragment", "text/html", "<p>No body</p>", "<p>No body</p>"},
+		{"feed", "application/atom+xml", "<feed></body></feed>", "<feed></body></feed>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := NewReloadBroker().InjectScript(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.Header().Set("ETag", `"page"`)
+				w.WriteHeader(201)
+				io.WriteString(w, test.body)
+			}))
+
+			rec := requestPage(handler, "/", nil)
+			if rec.Code != 201 {
+				t.Errorf("status %d, want 201", rec.Code)
+			}
+			if rec.Body.String() != test.want {
+				t.Errorf("body %q, want %q", rec.Body.String(), test.want)
+			}
+			// The validator of the page does not cover the script
+			if injected := test.want != test.body; injected != (rec.Header().Get("ETag") == "") {
+				t.Errorf("ETag %q after injecting %v", rec.Header().Get("ETag"), injected)
+			}
+		})
+	}
+}
+
+func TestReloadBroker(t *testing.T) {
+	broker := NewReloadBroker()
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type %q", got)
+	}
+
+	// Subscribing happens after the headers are sent
+	for i := 0; i < 100; i++ {
+		broker.mutex.Lock()
+		subscribed := len(broker.clients)
+		broker.mutex.Unlock()
+		if subscribed > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	broker.Notify()
+	lines := bufio.NewReader(res.Body)
+	line, err := lines.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "event: reload" {
+		t.Fatalf("read %q (%v), want a reload event", line, err)
+	}
+
+	// Closing ends the stream
+	broker.Close()
+	done := make(chan error, 1)
+	go func(){
+		_, err := io.ReadAll(lines)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("stream ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after Close")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"time"
+	"strings"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ArticleRevision struct {
+	Id int64
+	ArticleId int64
+	Markdown string
+	Content HTML
+	Hash string
+	CreatedAt time.Time
+}
+
+// Identifies the source of a revision. Unlike the article hash it does not
+// change with the renderer or markdown options.
+func revisionHash(markdown string) string {
+	sum := sha256.Sum256([]byte(markdown))
+	return hex.EncodeToString(sum[:])
+}
+
+// Records the current version of an article unless its source is identical to
+// the latest revision.
+func addArticleRevision(tx *sqlx.Tx, articleId int64, article Article) error {
+	_, err := tx.Exec(`
+		INSERT INTO ArticleRevision(
+			ArticleId, Markdown, Content, Hash, CreatedAt
+		)
+		SELECT
+			?, ?, ?, ?, CURRENT_TIMESTAMP
+		WHERE
+			(
+				SELECT Markdown FROM ArticleRevision WHERE ArticleId = ? ORDER BY Id DESC LIMIT 1
+			) IS NOT ?
+	`, articleId, article.Markdown, article.Content, revisionHash(article.Markdown),
+		articleId, article.Markdown)
+
+	return err
+}
+
+// Lists revisions of an article, newest first
+func (repo *Repository) ListArticleRevisions(articleId int64) ([]ArticleRevision, error){
+	revisions := make([]ArticleRevision, 0, 8)
+
+	err := repo.db.Select(&revisions, `
+		SELECT
+			*
+		FROM
+			ArticleRevision
+		WHERE
+			ArticleId = ?
+		ORDER BY
+			Id DESC
+	`, articleId)
+
+	return revisions, err
+}
+
+func (repo *Repository) GetArticleRevision(articleId int64, id int64) (ArticleRevision, error){
+	revision := ArticleRevision{}
+
+	err := repo.db.Get(&revision, `
+		SELECT
+			*
+		FROM
+			ArticleRevision
+		WHERE
+			ArticleId = ? AND Id = ?
+	`, articleId, id)
+
+	return revision, err
+}
+
+type DiffOp byte
+
+const (
+	DiffEqual DiffOp = ' '
+	DiffInsert DiffOp = '+'
+	DiffDelete DiffOp = '-'
+)
+
+type DiffLine struct {
+	Op DiffOp
+	Text string
+	// Line numbers starting at 1, 0 when the line is not on that side
+	OldLine int
+	NewLine int
+}
+
+// Line based diff between two texts using the linear space variant of Myers'
+// algorithm, which finds the middle snake of an edit script and recurses on
+// both halves instead of keeping every step of the search.
+func DiffLines(oldText string, newText string) []DiffLine {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	offset := len(a) + len(b) + 2
+
+	d := differ{
+		a: a,
+		b: b,
+		offset: offset,
+		forward: make([]int, 2 * offset + 1),
+		backward: make([]int, 2 * offset + 1),
+		lines: make([]DiffLine, 0, len(a) + len(b)),
+	}
+	d.diff(0, len(a), 0, len(b))
+	return d.lines
+}
+
+type differ struct {
+	a, b []string
+	offset int
+	// Furthest reaching x on each diagonal, from the start and from the end
+	forward, backward []int
+	lines []DiffLine
+}
+
+func (d *differ) equal(x int, y int) {
+	d.lines = append(d.lines, DiffLine{Op: DiffEqual, Text: d.a[x], OldLine: x + 1, NewLine: y + 1})
+}
+
+func (d *differ) diff(aLo int, aHi int, bLo int, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.equal(aLo, bLo)
+		aLo, bLo = aLo + 1, bLo + 1
+	}
+
+	suffix := 0
+	for aLo < aHi - suffix && bLo < bHi - suffix && d.a[aHi - suffix - 1] == d.b[bHi - suffix - 1] {
+		suffix += 1
+	}
+	aHi, bHi = aHi - suffix, bHi - suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.lines = append(d.lines, DiffLine{Op: DiffInsert, Text: d.b[y], NewLine: y + 1})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.lines = append(d.lines, DiffLine{Op: DiffDelete, Text: d.a[x], OldLine: x + 1})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.diff(aLo, x, bLo, y)
+		for ; x < u; x, y = x + 1, y + 1 {
+			d.equal(x, y)
+		}
+		d.diff(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.equal(aHi + i, bHi + i)
+	}
+}
+
+// Searches from both ends at once until the paths overlap, returns the snake
+// (x, y) to (u, v) where they meet. Both ranges must be non empty.
+func (d *differ) middleSnake(aLo int, aHi int, bLo int, bHi int) (x, y, u, v int) {
+	n, m := aHi - aLo, bHi - bLo
+	delta := n - m
+	odd := delta % 2 != 0
+	off, forward, backward := d.offset, d.forward, d.backward
+	forward[off + 1] = 0
+	backward[off + 1] = 0
+
+	for D := 0; D <= (n + m + 1) / 2; D++ {
+		for k := -D; k <= D; k += 2 {
+			x := forward[off + k - 1] + 1
+			if k == -D || (k != D && forward[off + k - 1] < forward[off + k + 1]) {
+				x = forward[off + k + 1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo + x] == d.b[bLo + y] {
+				x, y = x + 1, y + 1
+			}
+			forward[off + k] = x
+
+			// Diagonal k of the forward search is delta - k from the end
+			kr := delta - k
+			if odd && kr >= -(D - 1) && kr <= D - 1 && x + backward[off + kr] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for kr := -D; kr <= D; kr += 2 {
+			x := backward[off + kr - 1] + 1
+			if kr == -D || (kr != D && backward[off + kr - 1] < backward[off + kr + 1]) {
+				x = backward[off + kr + 1]
+			}
+			y := x - kr
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi - x - 1] == d.b[bHi - y - 1] {
+				x, y = x + 1, y + 1
+			}
+			backward[off + kr] = x
+
+			k := delta - kr
+			if !odd && k >= -D && k <= D && x + forward[off + k] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	// Unreachable, the searches overlap after at most (n + m + 1) / 2 steps
+	return aLo, bLo, aLo, bLo
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
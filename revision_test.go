@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"math/rand/v2"
+)
+
+// Writes a diff as one "<op><text>" line per entry
+func formatDiff(lines []DiffLine) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&sb, "%c%s\n", line.Op, line.Text)
+	}
+	return sb.String()
+}
+
+// Length of the longest common subsequence, computed the quadratic way
+func lcsLength(a []string, b []string) int {
+	prev := make([]int, len(b) + 1)
+	curr := make([]int, len(b) + 1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				curr[j + 1] = prev[j] + 1
+			} else {
+				curr[j + 1] = max(prev[j + 1], curr[j])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// Checks that the diff turns a into b, numbers lines correctly and makes no
+// more edits than necessary
+func checkDiff(t *testing.T, oldText string, newText string, lines []DiffLine) {
+	t.Helper()
+	a := splitLines(oldText)
+	b := splitLines(newText)
+
+	gotA := make([]string, 0, len(a))
+	gotB := make([]string, 0, len(b))
+	edits := 0
+	for i, line := range lines {
+		if line.Op != DiffInsert {
+			gotA = append(gotA, line.Text)
+			if line.OldLine != len(gotA) {
+				t.Errorf("line %d: old line %d, want %d", i, line.OldLine, len(gotA))
+			}
+		} else if line.OldLine != 0 {
+			t.Errorf("line %d: inserted line has old line %d", i, line.OldLine)
+		}
+
+		if line.Op != DiffDelete {
+			gotB = append(gotB, line.Text)
+			if line.NewLine != len(gotB) {
+				t.Errorf("line %d: new line %d, want %d", i, line.NewLine, len(gotB))
+			}
+		} else if line.NewLine != 0 {
+			t.Errorf("line %d: deleted line has new line %d", i, line.NewLine)
+		}
+
+		if line.Op != DiffEqual {
+			edits += 1
+		}
+	}
+
+	if !slices.Equal(gotA, a) {
+		t.Errorf("old side %q, want %q", gotA, a)
+	}
+	if !slices.Equal(gotB, b) {
+		t.Errorf("new side %q, want %q", gotB, b)
+	}
+	if want := len(a) + len(b) - 2 * lcsLength(a, b); edits != want {
+		t.Errorf("%d edits, want %d", edits, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old string
+		new string
+		want string
+	}{
+		{"both empty", "", "", ""},
+		{"identical", "a\nb\n", "a\nb\n", " a\n b\n"},
+		{"from empty", "", "a\nb\n", "+a\n+b\n"},
+		{"to empty", "a\nb\n", "", "-a\n-b\n"},
+		{"missing final newline", "a\nb", "a\nb\n", " a\n b\n"},
+		{"change in the middle", "a\nb\nc\n", "a\nx\nc\n", " a\n-b\n+x\n c\n"},
+		{"insert at start", "b\nc\n", "a\nb\nc\n", "+a\n b\n c\n"},
+		{"delete at end", "a\nb\nc\n", "a\nb\n", " a\n b\n-c\n"},
+		{"nothing in common", "a\nb\n", "c\nd\n", "-a\n-b\n+c\n+d\n"},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", "-a\n b\n c\n+a\n"},
+		{"repeated lines", "x\nx\nx\n", "x\nx\n", " x\n x\n-x\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := DiffLines(test.old, test.new)
+			if got := formatDiff(lines); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+			checkDiff(t, test.old, test.new, lines)
+		})
+	}
+}
+
+// Compares against a quadratic LCS on random texts over a small alphabet, so
+// lines repeat and the middle snake is found on many different diagonals
+func TestDiffLinesRandom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomText := func() string {
+		lines := make([]string, rng.IntN(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for i := 0; i < 500; i++ {
+		oldText, newText := randomText(), randomText()
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			checkDiff(t, oldText, newText, DiffLines(oldText, newText))
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"log"
+	"time"
+	"strings"
+	"unicode/utf8"
+	"html/template"
+	_ "embed"
+)
+
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag, when
+// it is missing search falls back to plain LIKE queries.
+//go:embed search.sql
+var SEARCH_SCHEMA string
+
+const (
+	highlightStart = "\x02"
+	highlightEnd = "\x03"
+	snippetTokens = 24
+	maxSearchResults = 50
+)
+
+type SearchResult struct {
+	Article Article
+	Title HTML
+	Snippet HTML
+}
+
+// Sets up the FTS5 index when go-sqlite3 was built with it and logs which
+// search is in use
+func (repo *Repository) initSearch() error {
+	var available, synced int
+	err := repo.db.Get(&available, `
+		SELECT count(*) FROM pragma_compile_options WHERE compile_options = 'ENABLE_FTS5'
+	`)
+	if err != nil { return err }
+	err = repo.db.Get(&synced, `
+		SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'ArticleSearchUpdate'
+	`)
+	if err != nil { return err }
+
+	// The triggers would make every write fail without the fts5 module
+	if available == 0 {
+		log.Println("Search: simple, build with '-tags sqlite_fts5' for full text search")
+		_, err = repo.db.Exec(`
+			DROP TRIGGER IF EXISTS ArticleSearchInsert;
+			DROP TRIGGER IF EXISTS ArticleSearchDelete;
+			DROP TRIGGER IF EXISTS ArticleSearchUpdate;
+		`)
+		return err
+	}
+
+	_, err = repo.db.Exec(SEARCH_SCHEMA)
+	if err != nil { return err }
+
+	// Without the triggers the index may be missing articles, e.g. when the
+	// database was last opened by a build without FTS5
+	if synced == 0 {
+		_, err = repo.db.Exec(`INSERT INTO ArticleSearch(ArticleSearch) VALUES ('rebuild')`)
+		if err != nil { return err }
+	}
+
+	log.Println("Search: full text (FTS5)")
+	repo.fts = true
+	return nil
+}
+
+// Splits a user query into terms, dropping anything that is not part of a word
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '\'' || r >= utf8.RuneSelf ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	})
+}
+
+// Every term is quoted so user input is never interpreted as FTS5 syntax, the
+// last term also matches as a prefix.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	quoted[len(quoted) - 1] += "*"
+	return strings.Join(quoted, " ")
+}
+
+// Lists published articles matching query, best matches first.
+func (repo *Repository) SearchArticles(query string) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	if !repo.fts {
+		return repo.searchArticlesSimple(terms)
+	}
+
+	rows, err := repo.db.Queryx(`
+		SELECT
+			 Article.*
+			,highlight(ArticleSearch, 0, ?, ?) AS TitleHighlight
+			,snippet(ArticleSearch, 1, ?, ?, '…', ?) AS Snippet
+		FROM
+			ArticleSearch
+			INNER JOIN Article ON Article.Id = ArticleSearch.rowid
+		WHERE
+			ArticleSearch MATCH ? AND ` + publishedCondition + `
+		ORDER BY
+			rank
+		LIMIT ?
+	`, highlightStart, highlightEnd, highlightStart, highlightEnd, snippetTokens,
+		ftsQuery(terms), time.Now().UTC(), maxSearchResults)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0, 8)
+
+	for rows.Next() {
+		row := struct {
+			Article
+			TitleHighlight string
+			Snippet string
+		}{}
+
+		err = rows.StructScan(&row)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, SearchResult{
+			Article: row.Article,
+			Title: renderHighlights(row.TitleHighlight),
+			Snippet: renderHighlights(row.Snippet),
+		})
+	}
+
+	return results, rows.Err()
+}
+
+func (repo *Repository) searchArticlesSimple(terms []string) ([]SearchResult, error) {
+	where := make([]string, len(terms))
+	args := make([]any, 0, len(terms) * 2 + 1)
+
+	for i, term := range terms {
+		where[i] = `(RawTitle LIKE ? ESCAPE '\' OR Text LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(term) + "%"
+		args = append(args, pattern, pattern)
+	}
+	args = append(args, time.Now().UTC())
+
+	articles, err := repo.queryArticles(`
+		SELECT
+			*
+		FROM
+			Article
+		WHERE
+			` + strings.Join(where, " AND ") + `
+			AND ` + publishedCondition + `
+		LIMIT ?
+	`, append(args, maxSearchResults)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, len(articles))
+	for i, article := range articles {
+		results[i] = SearchResult{
+			Article: article,
+			Title: renderHighlights(markTerms(article.RawTitle, terms)),
+			Snippet: renderHighlights(markTerms(textWindow(article.Text, terms), terms)),
+		}
+	}
+
+	return results, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Cuts a window of text around the first occurrence of any term
+func textWindow(text string, terms []string) string {
+	const radius = 120
+
+	lower := strings.ToLower(text)
+	pos := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+
+	if pos < 0 {
+		pos = 0
+	}
+
+	start, end := max(pos - radius, 0), min(pos + radius, len(text))
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start -= 1
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end += 1
+	}
+
+	window := text[start:end]
+	if start > 0 {
+		window = "…" + window
+	}
+	if end < len(text) {
+		window += "…"
+	}
+	return window
+}
+
+// Surrounds case insensitive occurrences of terms with highlight markers
+func markTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return text
+	}
+	sb := strings.Builder{}
+
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, term := range terms {
+			t := strings.ToLower(term)
+			if len(t) == len(term) && strings.HasPrefix(lower[i:], t) {
+				matched = max(matched, len(t))
+			}
+		}
+
+		if matched > 0 {
+			sb.WriteString(highlightStart + text[i:i + matched] + highlightEnd)
+			i += matched
+		} else {
+			sb.WriteByte(text[i])
+			i += 1
+		}
+	}
+
+	return sb.String()
+}
+
+// Escapes text and turns highlight markers into <mark> elements
+func renderHighlights(text string) HTML {
+	escaped := template.HTMLEscapeString(text)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+	return HTML(escaped)
+}
@@ -0,0 +1,20 @@
+create virtual table if not exists ArticleSearch using fts5(
+	 RawTitle
+	,Text
+	,content = 'Article'
+	,content_rowid = 'Id'
+	,tokenize = 'porter unicode61'
+);
+
+create trigger if not exists ArticleSearchInsert after insert on Article begin
+	insert into ArticleSearch(rowid, RawTitle, Text) values (new.Id, new.RawTitle, new.Text);
+end;
+
+create trigger if not exists ArticleSearchDelete after delete on Article begin
+	insert into ArticleSearch(ArticleSearch, rowid, RawTitle, Text) values ('delete', old.Id, old.RawTitle, old.Text);
+end;
+
+create trigger if not exists ArticleSearchUpdate after update on Article begin
+	insert into ArticleSearch(ArticleSearch, rowid, RawTitle, Text) values ('delete', old.Id, old.RawTitle, old.Text);
+	insert into ArticleSearch(rowid, RawTitle, Text) values (new.Id, new.RawTitle, new.Text);
+end;
\ No newline at end of file
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []string
+		fts string
+	}{
+		{"go", []string{"go"}, `"go"*`},
+		{"  sqlite   fts5 ", []string{"sqlite", "fts5"}, `"sqlite" "fts5"*`},
+		{`"quoted" AND (x OR y)`, []string{"quoted", "AND", "x", "OR", "y"}, `"quoted" "AND" "x" "OR" "y"*`},
+		{"don't re-run snake_case", []string{"don't", "re-run", "snake_case"}, `"don't" "re-run" "snake_case"*`},
+		{"café naïve", []string{"café", "naïve"}, `"café" "naïve"*`},
+		{"*:^", nil, ""},
+	}
+
+	for _, test := range tests {
+		terms := searchTerms(test.query)
+		if !slices.Equal(terms, test.terms) {
+			t.Errorf("searchTerms(%q) = %q, want %q", test.query, terms, test.terms)
+			continue
+		}
+		if len(terms) > 0 {
+			if fts := ftsQuery(terms); fts != test.fts {
+				t.Errorf("ftsQuery(%q) = %s, want %s", terms, fts, test.fts)
+			}
+		}
+	}
+}
+
+func TestMarkTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		terms []string
+		want HTML
+	}{
+		{"Go and SQLite", []string{"sqlite"}, "Go and <mark>SQLite</mark>"},
+		{"go go", []string{"go"}, "<mark>go</mark> <mark>go</mark>"},
+		{"testing tests", []string{"test", "testing"}, "<mark>testing</mark> <mark>test</mark>s"},
+		{"<b> & go", []string{"go"}, "&lt;b&gt; &amp; <mark>go</mark>"},
+		{"nothing", []string{"go"}, "nothing"},
+	}
+
+	for _, test := range tests {
+		if got := renderHighlights(markTerms(test.text, test.terms)); got != test.want {
+			t.Errorf("markTerms(%q, %q) = %s, want %s", test.text, test.terms, got, test.want)
+		}
+	}
+}
+
+func TestTextWindow(t *testing.T) {
+	text := strings.Repeat("a ", 200) + "needle" + strings.Repeat(" b", 200)
+
+	window := textWindow(text, []string{"NEEDLE"})
+	if !strings.Contains(window, "needle") || !strings.HasPrefix(window, "…") || !strings.HasSuffix(window, "…") {
+		t.Errorf("window %q", window)
+	}
+	if len(window) > 250 + 2 * len("…") {
+		t.Errorf("window of %d bytes", len(window))
+	}
+
+	if window := textWindow("short text", []string{"missing"}); window != "short text" {
+		t.Errorf("window %q", window)
+	}
+}
+
+func TestSearchArticles(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "sqlite", "---\ntitle: Using SQLite\ndate: 2024-03-01\n---\nFull text search with sqlite and Go.\n")
+	createTestArticle(t, repo, "go", "---\ntitle: Go tips\ndate: 2024-03-02\n---\nGoroutines and 100% channels.\n")
+	createTestArticle(t, repo, "draft", "---\ntitle: SQLite draft\ndraft: true\n---\nNot yet.\n")
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"sqlite", []string{"sqlite"}},
+		{"SQLITE", []string{"sqlite"}},
+		{"go", []string{"go", "sqlite"}},
+		{"sqlite go", []string{"sqlite"}},
+		{"chan", []string{"go"}},
+		{"100", []string{"go"}},
+		{"missing", nil},
+		{"", nil},
+		{"%", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			results, err := repo.SearchArticles(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, 0, len(results))
+			for _, result := range results {
+				names = append(names, result.Article.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, test.names) {
+				t.Errorf("results %v, want %v", names, test.names)
+			}
+		})
+	}
+
+	results, err := repo.SearchArticles("sqlite")
+	if err != nil || len(results) != 1 {
+		t.Fatalf("results %v (%v)", results, err)
+	}
+	if !strings.Contains(string(results[0].Title), "<mark>SQLite</mark>") || !strings.Contains(string(results[0].Snippet), "<mark>sqlite</mark>") {
+		t.Errorf("highlights missing from %s and %s", results[0].Title, results[0].Snippet)
+	}
+}
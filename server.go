@@ -0,0 +1,935 @@
+package main
+
+import (
+	"log"
+	"io"
+	"fmt"
+	"errors"
+	"context"
+	"syscall"
+	"os/signal"
+	"crypto/subtle"
+	"crypto/sha256"
+	"encoding/hex"
+	"bytes"
+	"strconv"
+	"sync/atomic"
+	"os"
+	"io/fs"
+	"time"
+	"net"
+	"net/http"
+	"database/sql"
+	"html/template"
+	"path/filepath"
+	texttemplate "text/template"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const dateFormat = "2006-01-02"
+
+type Templates struct {
+	Index *template.Template
+	Article *template.Template
+	Tag *template.Template
+	Tags *template.Template
+	Search *template.Template
+	History *template.Template
+	Archive *template.Template
+	Robots *texttemplate.Template
+	// Static files the asset function resolves
+	Assets *AssetManifest
+	// Hash of every template and asset, part of page validators
+	Version string
+	// Newest modification time of the template files and assets, pages
+	// rendered with these templates are no older than this
+	ModTime time.Time
+}
+
+// Reads a template from dir, falling back to the embedded default when the
+// file does not exist, so blogs created before a template was added still work.
+func readTemplate(dir string, name string, fallback []byte) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return string(fallback), nil
+	}
+	return string(data), err
+}
+
+func parseTemplate(dir string, name string, fallback []byte, funcs template.FuncMap) (*template.Template, error) {
+	data, err := readTemplate(dir, name, fallback)
+	if err != nil { return nil, err }
+
+	return template.New(name).Funcs(funcs).Parse(data)
+}
+
+// Same as parseTemplate for plain text files that must not be HTML escaped
+func parseTextTemplate(dir string, name string, fallback []byte) (*texttemplate.Template, error) {
+	data, err := readTemplate(dir, name, fallback)
+	if err != nil { return nil, err }
+
+	return texttemplate.New(name).Parse(data)
+}
+
+// Newest modification time of the templates in dir. Templates missing from
+// dir are the embedded defaults, which only change along with the executable.
+func templatesModTime(dir string, names []string) (time.Time, error) {
+	var modTime time.Time
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			info, err = executableInfo()
+		}
+		if err != nil { return modTime, err }
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func executableInfo() (fs.FileInfo, error) {
+	path, err := os.Executable()
+	if err != nil { return nil, err }
+	return os.Stat(path)
+}
+
+// Parses the templates in dir, asset "name" in a template is the fingerprinted
+// URL of static/name
+func LoadTemplates(dir string, assets *AssetManifest) (*Templates, error) {
+	var err error
+	templates := &Templates{Assets: assets}
+	funcs := template.FuncMap{
+		"asset": assets.URL,
+		"tagURL": tagURL,
+	}
+
+	templates.Index, err = parseTemplate(dir, "index.html", indexTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Article, err = parseTemplate(dir, "article.html", articleTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Tag, err = parseTemplate(dir, "tag.html", tagTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Tags, err = parseTemplate(dir, "tags.html", tagsTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Search, err = parseTemplate(dir, "search.html", searchTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.History, err = parseTemplate(dir, "history.html", historyTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Archive, err = parseTemplate(dir, "archive.html", archiveTemplateData, funcs)
+	if err != nil { return nil, err }
+
+	templates.Robots, err = parseTextTemplate(dir, "robots.txt", robotsTemplateData)
+	if err != nil { return nil, err }
+
+	h := sha256.New()
+	if assets != nil {
+		io.WriteString(h, assets.Version)
+	}
+	for _, tmpl := range []*template.Template{templates.Index, templates.Article, templates.Tag, templates.Tags, templates.Search, templates.History, templates.Archive} {
+		io.WriteString(h, tmpl.Tree.Root.String())
+	}
+	templates.Version = hex.EncodeToString(h.Sum(nil)[:8])
+
+	templates.ModTime, err = templatesModTime(dir, []string{"index.html", "article.html", "tag.html", "tags.html", "search.html", "history.html", "archive.html", "robots.txt"})
+	if err != nil { return nil, err }
+	if assets != nil && assets.ModTime.After(templates.ModTime) {
+		templates.ModTime = assets.ModTime
+	}
+
+	return templates, nil
+}
+
+type articleView struct {
+	Name string
+	Title HTML
+	RawTitle string
+	Content HTML
+	Summary HTML
+	TOC HTML
+	// The table of contents is already part of Content
+	TOCInline bool
+	Description string
+	Author string
+	Tags []string
+	Extra map[string]any
+	PublishedAt string
+	Published bool
+	// Publish date shown in article lists
+	Date string
+	CreatedAt string
+	UpdatedAt string
+	ArticleStats
+}
+
+func newArticleView(article Article) articleView {
+	return articleView{
+		Name: article.Name,
+		Title: article.Title,
+		RawTitle: article.RawTitle,
+		Content: article.Content,
+		Summary: article.Summary,
+		TOC: article.TOC.HTML(),
+		TOCInline: article.TOC.Inline,
+		Description: article.Description,
+		Author: article.Author,
+		Tags: article.Tags,
+		Extra: article.Extra,
+		PublishedAt: formatDate(article.PublishedAt),
+		Published: article.IsPublished(time.Now()),
+		Date: article.PublishDate().Format(dateFormat),
+		CreatedAt: article.CreatedAt.Format(dateFormat),
+		UpdatedAt: article.UpdatedAt.Format(dateFormat),
+		ArticleStats: article.ArticleStats,
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateFormat)
+}
+
+func RenderArticle(w io.Writer, tmpl *template.Template, site Site, article Article) error {
+	type templateData struct {
+		articleView
+		Site Site
+	}
+
+	return tmpl.Execute(w, templateData{newArticleView(article), site})
+}
+
+func RenderIndexPage(w io.Writer, tmpl *template.Template, site Site, articles []Article, pagination Pagination) error {
+	type templateData struct {
+		ArticleList []articleView
+		PageTitle string
+		Pagination Pagination
+		Site Site
+	}
+
+	data := templateData{
+		ArticleList: make([]articleView, len(articles)),
+		PageTitle: site.Title,
+		Pagination: pagination,
+		Site: site,
+	}
+
+	for i, article := range articles {
+		data.ArticleList[i] = newArticleView(article)
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func RenderTagPage(w io.Writer, tmpl *template.Template, site Site, tag string, articles []Article) error {
+	type templateData struct {
+		ArticleList []articleView
+		PageTitle string
+		Tag string
+		Site Site
+	}
+
+	data := templateData{
+		ArticleList: make([]articleView, len(articles)),
+		PageTitle: "Articles tagged " + tag,
+		Tag: tag,
+		Site: site,
+	}
+
+	for i, article := range articles {
+		data.ArticleList[i] = newArticleView(article)
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func RenderTagsPage(w io.Writer, tmpl *template.Template, site Site, tags []TagCount) error {
+	type templateData struct {
+		TagList []TagCount
+		PageTitle string
+		Site Site
+	}
+
+	data := templateData{
+		TagList: tags,
+		PageTitle: "Tags",
+		Site: site,
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func RenderSearchPage(w io.Writer, tmpl *template.Template, site Site, query string, results []SearchResult) error {
+	type resultView struct {
+		articleView
+		Title HTML
+		Snippet HTML
+	}
+
+	type templateData struct {
+		ResultList []resultView
+		PageTitle string
+		Query string
+		Site Site
+	}
+
+	data := templateData{
+		ResultList: make([]resultView, len(results)),
+		PageTitle: "Search",
+		Query: query,
+		Site: site,
+	}
+
+	for i, result := range results {
+		data.ResultList[i] = resultView{
+			articleView: newArticleView(result.Article),
+			Title: result.Title,
+			Snippet: result.Snippet,
+		}
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func RenderHistoryPage(w io.Writer, tmpl *template.Template, site Site, article Article, revisions []ArticleRevision, from ArticleRevision, to ArticleRevision) error {
+	type revisionView struct {
+		Id int64
+		Hash string
+		CreatedAt string
+	}
+
+	type diffLineView struct {
+		Op string
+		Text string
+		OldLine int
+		NewLine int
+	}
+
+	type templateData struct {
+		Article articleView
+		RevisionList []revisionView
+		PageTitle string
+		From int64
+		To int64
+		Diff []diffLineView
+		Site Site
+	}
+
+	data := templateData{
+		Article: newArticleView(article),
+		RevisionList: make([]revisionView, len(revisions)),
+		PageTitle: "History of " + article.RawTitle,
+		From: from.Id,
+		To: to.Id,
+		Site: site,
+	}
+
+	for i, revision := range revisions {
+		data.RevisionList[i] = revisionView{
+			Id: revision.Id,
+			Hash: revision.Hash[:min(len(revision.Hash), 12)],
+			CreatedAt: revision.CreatedAt.Format("2006-01-02 15:04"),
+		}
+	}
+
+	ops := map[DiffOp]string{DiffEqual: "equal", DiffInsert: "insert", DiffDelete: "delete"}
+	for _, line := range DiffLines(from.Markdown, to.Markdown) {
+		data.Diff = append(data.Diff, diffLineView{
+			Op: ops[line.Op],
+			Text: line.Text,
+			OldLine: line.OldLine,
+			NewLine: line.NewLine,
+		})
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+func httpError(w http.ResponseWriter, status int){
+	http.Error(w, http.StatusText(status), status)
+}
+
+type ServerOptions struct {
+	Site Site
+	PreviewToken string
+	Feed FeedOptions
+	// Reload articles, templates and open pages when files change
+	Watch bool
+	Sync SyncOptions
+	// Articles per index page, 0 puts all of them on one page
+	PageSize int
+	Sitemap SitemapOptions
+	Cache CacheOptions
+	// Rendered pages kept in memory, 0 disables the page cache
+	PageCacheSize int
+	Timeouts ServerTimeouts
+	ArticlesDir string
+	TemplatesDir string
+	StaticDir string
+}
+
+type ServerTimeouts struct {
+	// Reading a whole request, headers included
+	Read time.Duration
+	Write time.Duration
+	// Keep-alive connections waiting for the next request
+	Idle time.Duration
+	// In-flight requests are given this long to finish on shutdown
+	Shutdown time.Duration
+}
+
+// Unpublished articles can only be seen by passing the preview token in the
+// "preview" query parameter. An empty token disables previews.
+func isPreview(r *http.Request, previewToken string) bool {
+	if previewToken == "" {
+		return false
+	}
+	token := r.URL.Query().Get("preview")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(previewToken)) == 1
+}
+
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// Serves a rendered feed, validators are derived from the feed contents so
+// conditional requests get a 304 when nothing changed.
+func serveFeed(w http.ResponseWriter, r *http.Request, feed Feed, format FeedFormat) {
+	data, err := feed.Render(format)
+	if err != nil {
+		log.Println("Failed to render feed:", err.Error())
+		httpError(w, 500)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("ETag", `"` + hex.EncodeToString(sum[:16]) + `"`)
+	http.ServeContent(w, r, "", feed.Updated, bytes.NewReader(data))
+}
+
+type Server struct {
+	repo *Repository
+	opts ServerOptions
+	templates atomic.Pointer[Templates]
+	// Only set when watching for changes
+	reload *ReloadBroker
+	pages *PageCache
+}
+
+func NewServer(repo *Repository, templates *Templates, opts ServerOptions) *Server {
+	server := &Server{
+		repo: repo,
+		opts: opts,
+	}
+	server.templates.Store(templates)
+	server.pages = NewPageCache(opts.PageCacheSize, func() time.Time {
+		next, err := repo.NextPublication(time.Now())
+		if err != nil {
+			log.Println("Failed to get next publication:", err.Error())
+		}
+		return next
+	})
+	return server
+}
+
+func (server *Server) Templates() *Templates {
+	return server.templates.Load()
+}
+
+func (server *Server) SetTemplates(templates *Templates) {
+	server.templates.Store(templates)
+	server.pages.Invalidate()
+}
+
+// Looks up the article named in the URL and answers with an error if it does
+// not exist or may not be shown.
+func (server *Server) visibleArticle(w http.ResponseWriter, r *http.Request) (Article, bool) {
+	name := chi.URLParam(r, "name")
+
+	article, err := server.repo.GetArticleByName(name)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpError(w, 404)
+		return article, false
+	} else if err != nil {
+		log.Println("Failed to get article:", err.Error())
+		httpError(w, 500)
+		return article, false
+	}
+
+	if article.Deleted {
+		httpError(w, 410)
+		return article, false
+	}
+
+	if !article.IsPublished(time.Now()) {
+		if !isPreview(r, server.opts.PreviewToken) {
+			httpError(w, 404)
+			return article, false
+		}
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	return article, true
+}
+
+func (server *Server) Router() *chi.Mux {
+	repo, opts := server.repo, server.opts
+
+	router := chi.NewRouter()
+	router.Use(middleware.Compress(5))
+	router.Use(middleware.GetHead)
+	if server.reload != nil {
+		router.Use(server.reload.InjectScript)
+		router.Get(reloadPath, server.reload.ServeHTTP)
+	}
+	fileServer := http.FileServer(http.Dir(opts.StaticDir))
+
+	// Pages change under the reader when watching, caches would hide that
+	cache := opts.Cache
+	if server.reload != nil {
+		cache = CacheOptions{Pages: "no-cache", Articles: "no-cache", Feeds: "no-cache", Static: "no-cache"}
+	}
+	// Site settings show up on every page, so they are part of the validators
+	siteVersion := fmt.Sprintf("%+v", opts.Site)
+
+	// Live reload rewrites pages, so cached ones must stay uncompressed
+	cached := server.pages.Middleware(server.reload == nil)
+	pages := router.With(cacheControl(cache.Pages))
+	cachedPages := pages.With(cached)
+	feeds := router.With(cacheControl(cache.Feeds))
+
+	serveIndexPage := func(w http.ResponseWriter, r *http.Request, page int){
+		listOpts := pageListOptions(opts.PageSize)
+		listOpts.Offset = (page - 1) * opts.PageSize
+
+		articles, err := repo.ListPublishedArticles(listOpts)
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		if page > 1 && len(articles) == 0 {
+			httpError(w, 404)
+			return
+		}
+
+		articles, hasOlder := splitPage(articles, opts.PageSize)
+		pagination := NewPagination(page, hasOlder)
+
+		lastChange, err := repo.LastChange()
+		if err != nil {
+			log.Println("Failed to get last change:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		templates := server.Templates()
+		etag := articleListETag(templates.Version, articles, siteVersion, pagination.Newer, pagination.Older)
+		servePage(w, r, etag, lastUpdated(articles, lastChange, templates.ModTime), func(w io.Writer) error {
+			return RenderIndexPage(w, templates.Index, opts.Site, articles, pagination)
+		})
+	}
+
+	cachedPages.Get("/", func(w http.ResponseWriter, r *http.Request){
+		serveIndexPage(w, r, 1)
+	})
+
+	cachedPages.Get("/page/{page:[0-9]+}", func(w http.ResponseWriter, r *http.Request){
+		page, err := strconv.Atoi(chi.URLParam(r, "page"))
+		if err != nil || opts.PageSize <= 0 {
+			httpError(w, 404)
+			return
+		}
+		if page <= 1 {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+		serveIndexPage(w, r, page)
+	})
+
+	serveArchivePage := func(w http.ResponseWriter, r *http.Request, year int, month time.Month){
+		listOpts := ListOptions{}
+		if year != 0 {
+			listOpts.Since, listOpts.Until = ArchiveRange(year, month)
+		}
+
+		articles, err := repo.ListPublishedArticles(listOpts)
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		if year != 0 && len(articles) == 0 {
+			httpError(w, 404)
+			return
+		}
+
+		lastChange, err := repo.LastChange()
+		if err != nil {
+			log.Println("Failed to get last change:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		title := archiveTitle(year, month)
+		templates := server.Templates()
+		etag := articleListETag(templates.Version, articles, siteVersion, title)
+		servePage(w, r, etag, lastUpdated(articles, lastChange, templates.ModTime), func(w io.Writer) error {
+			return RenderArchivePage(w, templates.Archive, opts.Site, title, articles)
+		})
+	}
+
+	cachedPages.Get("/archive", func(w http.ResponseWriter, r *http.Request){
+		serveArchivePage(w, r, 0, 0)
+	})
+
+	cachedPages.Get("/{year:[0-9]{4}}", func(w http.ResponseWriter, r *http.Request){
+		year, _ := strconv.Atoi(chi.URLParam(r, "year"))
+		serveArchivePage(w, r, year, 0)
+	})
+
+	cachedPages.Get("/{year:[0-9]{4}}/{month:[0-9]{2}}", func(w http.ResponseWriter, r *http.Request){
+		year, _ := strconv.Atoi(chi.URLParam(r, "year"))
+		month, _ := strconv.Atoi(chi.URLParam(r, "month"))
+		if month < 1 || month > 12 {
+			httpError(w, 404)
+			return
+		}
+		serveArchivePage(w, r, year, time.Month(month))
+	})
+
+	staticFiles := http.StripPrefix("/static/", fileServer)
+	router.With(cacheControl(cache.Static)).Get("/static/*", func(w http.ResponseWriter, r *http.Request){
+		if !server.Templates().Assets.Serve(w, r, chi.URLParam(r, "*")) {
+			staticFiles.ServeHTTP(w, r)
+		}
+	})
+
+	router.With(cacheControl(cache.Articles), cached).Get("/article/{name}", func(w http.ResponseWriter, r *http.Request){
+		article, ok := server.visibleArticle(w, r)
+		if !ok {
+			return
+		}
+
+		templates := server.Templates()
+		etag := contentETag(templates.Version, siteVersion, article.Name, article.Hash)
+		servePage(w, r, etag, lastUpdated([]Article{article}, templates.ModTime), func(w io.Writer) error {
+			return RenderArticle(w, templates.Article, opts.Site, article)
+		})
+	})
+
+	pages.Get("/article/{name}/history", func(w http.ResponseWriter, r *http.Request){
+		article, ok := server.visibleArticle(w, r)
+		if !ok {
+			return
+		}
+
+		revisions, err := repo.ListArticleRevisions(article.Id)
+		if err != nil {
+			log.Println("Failed to list revisions:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		// Defaults to the changes made by the latest revision
+		var from, to ArticleRevision
+		if len(revisions) > 0 {
+			to = revisions[0]
+		}
+		if len(revisions) > 1 {
+			from = revisions[1]
+		}
+
+		for param, revision := range map[string]*ArticleRevision{"from": &from, "to": &to} {
+			value := r.URL.Query().Get(param)
+			if value == "" {
+				continue
+			}
+
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				httpError(w, 400)
+				return
+			}
+
+			*revision, err = repo.GetArticleRevision(article.Id, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				httpError(w, 404)
+				return
+			} else if err != nil {
+				log.Println("Failed to get revision:", err.Error())
+				httpError(w, 500)
+				return
+			}
+		}
+
+		err = RenderHistoryPage(w, server.Templates().History, opts.Site, article, revisions, from, to)
+		if err != nil {
+			log.Println("Failed to execute template:", err.Error())
+		}
+	})
+
+	cachedPages.Get("/tags", func(w http.ResponseWriter, r *http.Request){
+		tags, err := repo.ListTags()
+		if err != nil {
+			log.Println("Failed to list tags:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		err = RenderTagsPage(w, server.Templates().Tags, opts.Site, tags)
+		if err != nil {
+			log.Println("Failed to execute template:", err.Error())
+		}
+	})
+
+	cachedPages.Get("/tag/{tag}", func(w http.ResponseWriter, r *http.Request){
+		tag := NormalizeTag(chi.URLParam(r, "tag"))
+
+		articles, err := repo.ListArticlesByTag(tag)
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		if len(articles) == 0 {
+			httpError(w, 404)
+			return
+		}
+
+		err = RenderTagPage(w, server.Templates().Tag, opts.Site, tag, articles)
+		if err != nil {
+			log.Println("Failed to execute template:", err.Error())
+		}
+	})
+
+	pages.Get("/search", func(w http.ResponseWriter, r *http.Request){
+		query := r.URL.Query().Get("q")
+
+		results, err := repo.SearchArticles(query)
+		if err != nil {
+			log.Println("Failed to search articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		err = RenderSearchPage(w, server.Templates().Search, opts.Site, query, results)
+		if err != nil {
+			log.Println("Failed to execute template:", err.Error())
+		}
+	})
+
+	feedOptions := func(r *http.Request) FeedOptions {
+		feedOpts := opts.Feed
+		if feedOpts.BaseURL == "" {
+			feedOpts.BaseURL = requestBaseURL(r)
+		}
+		return feedOpts
+	}
+
+	feeds.Get("/feed.{format:atom|rss|json}", func(w http.ResponseWriter, r *http.Request){
+		format := FeedFormat(chi.URLParam(r, "format"))
+
+		articles, err := repo.ListPublishedArticles(ListOptions{})
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		feed := NewFeed(opts.Site.Title, "/", r.URL.Path, articles, feedOptions(r))
+		serveFeed(w, r, feed, format)
+	})
+
+	feeds.Get("/{sitemap:sitemap(-[0-9]+)?}.xml", func(w http.ResponseWriter, r *http.Request){
+		articles, err := repo.ListPublishedArticles(ListOptions{})
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		tags, err := repo.ListTags()
+		if err != nil {
+			log.Println("Failed to list tags:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		files, err := BuildSitemaps(feedOptions(r).BaseURL, articles, tags, opts.Sitemap)
+		if err != nil {
+			log.Println("Failed to build sitemap:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		data, ok := files[chi.URLParam(r, "sitemap") + ".xml"]
+		if !ok {
+			httpError(w, 404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Write(data)
+	})
+
+	feeds.Get("/robots.txt", func(w http.ResponseWriter, r *http.Request){
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err := RenderRobots(w, server.Templates().Robots, feedOptions(r).BaseURL)
+		if err != nil {
+			log.Println("Failed to render robots.txt:", err.Error())
+			httpError(w, 500)
+		}
+	})
+
+	feeds.Get("/tag/{tag}/feed.{format:atom|rss|json}", func(w http.ResponseWriter, r *http.Request){
+		tag := NormalizeTag(chi.URLParam(r, "tag"))
+		format := FeedFormat(chi.URLParam(r, "format"))
+
+		articles, err := repo.ListArticlesByTag(tag)
+		if err != nil {
+			log.Println("Failed to list articles:", err.Error())
+			httpError(w, 500)
+			return
+		}
+
+		if len(articles) == 0 {
+			httpError(w, 404)
+			return
+		}
+
+		title := opts.Site.Title + ": " + tag
+		pagePath := tagURL(tag)
+		feed := NewFeed(title, pagePath, r.URL.Path, articles, feedOptions(r))
+		serveFeed(w, r, feed, format)
+	})
+
+	return router
+}
+
+// Syncs every article and reloads static assets and templates
+func (server *Server) Resync() error {
+	_, err := SyncArticles(server.opts.ArticlesDir, server.repo, server.opts.Sync)
+	if err != nil { return err }
+
+	assets, err := LoadAssets(server.opts.StaticDir, server.Templates().Assets)
+	if err != nil { return err }
+
+	templates, err := LoadTemplates(server.opts.TemplatesDir, assets)
+	if err != nil { return err }
+
+	// Also drops every cached page
+	server.SetTemplates(templates)
+
+	if server.reload != nil {
+		server.reload.Notify()
+	}
+	return nil
+}
+
+// Serves until SIGINT or SIGTERM, then waits for in-flight requests before
+// returning. SIGHUP syncs articles and reloads templates.
+func Serve(address string, repo *Repository, opts ServerOptions) error {
+	log.Println("Load static assets")
+	assets, err := LoadAssets(opts.StaticDir, nil)
+	if err != nil { return err }
+
+	log.Println("Load templates")
+	templates, err := LoadTemplates(opts.TemplatesDir, assets)
+	if err != nil { return err }
+
+	server := NewServer(repo, templates, opts)
+	if opts.Watch {
+		server.reload = NewReloadBroker()
+		go server.Watch()
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil { return err }
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	return server.serveUntilSignal(listener, signals)
+}
+
+// Serves on listener until signals receives anything but SIGHUP, then shuts
+// down within the shutdown timeout
+func (server *Server) serveUntilSignal(listener net.Listener, signals chan os.Signal) error {
+	opts := server.opts
+
+	log.Println("Router setup")
+	httpServer := &http.Server{
+		Handler: server.Router(),
+		ReadHeaderTimeout: opts.Timeouts.Read,
+		ReadTimeout: opts.Timeouts.Read,
+		WriteTimeout: opts.Timeouts.Write,
+		IdleTimeout: opts.Timeouts.Idle,
+	}
+	if server.reload != nil {
+		httpServer.RegisterOnShutdown(server.reload.Close)
+	}
+
+	serveErr := make(chan error, 1)
+	go func(){
+		log.Println("Listening on", listener.Addr())
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				log.Println("Resync articles and templates")
+				err := server.Resync()
+				if err != nil {
+					log.Println("Failed to resync:", err.Error())
+				}
+				continue
+			}
+
+			// A second signal kills the process right away
+			signal.Stop(signals)
+			log.Println("Shutting down, waiting up to", opts.Timeouts.Shutdown, "for open requests")
+
+			ctx, cancel := context.WithTimeout(context.Background(), opts.Timeouts.Shutdown)
+			defer cancel()
+
+			err := httpServer.Shutdown(ctx)
+			if err != nil {
+				log.Println("Failed to finish open requests:", err.Error())
+				httpServer.Close()
+			}
+
+			server.pages.LogStats()
+			server.pages.Invalidate()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io"
+	"os"
+	"net"
+	"time"
+	"syscall"
+	"testing"
+	"net/http"
+	"path/filepath"
+)
+
+func TestTemplatesModTime(t *testing.T) {
+	templatesTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assetTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	files := map[string][]byte{
+		"index.html": indexTemplateData,
+		"article.html": articleTemplateData,
+		"tag.html": tagTemplateData,
+		"tags.html": tagsTemplateData,
+		"search.html": searchTemplateData,
+		"history.html": historyTemplateData,
+		"archive.html": archiveTemplateData,
+		"robots.txt": robotsTemplateData,
+	}
+
+	tests := []struct {
+		name string
+		assetTime time.Time
+		want time.Time
+	}{
+		{"templates only", time.Time{}, templatesTime},
+		{"newer asset", assetTime, assetTime},
+		{"older asset", templatesTime.Add(-time.Hour), templatesTime},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range files {
+				p := filepath.Join(dir, name)
+				if err := os.WriteFile(p, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(p, templatesTime, templatesTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var assets *AssetManifest
+			if !test.assetTime.IsZero() {
+				staticDir := t.TempDir()
+				p := filepath.Join(staticDir, "style.css")
+				if err := os.WriteFile(p, []byte("body {}"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(p, test.assetTime, test.assetTime); err != nil {
+					t.Fatal(err)
+				}
+				var err error
+				assets, err = LoadAssets(staticDir, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			templates, err := LoadTemplates(dir, assets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !templates.ModTime.Equal(test.want) {
+				t.Errorf("modification time %v, want %v", templates.ModTime, test.want)
+			}
+		})
+	}
+}
+
+// Runs serveUntilSignal on a free port, returns its address and the result of
+// the call
+func startTestServer(t *testing.T, server *Server, signals chan os.Signal) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func(){
+		done <- server.serveUntilSignal(listener, signals)
+	}()
+	return "http://" + listener.Addr().String(), done
+}
+
+func waitForServer(t *testing.T, done chan error, timeout time.Duration) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve returned %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("server still running")
+	}
+}
+
+func TestServeUntilSignal(t *testing.T) {
+	newServer := func(t *testing.T, shutdown time.Duration) *Server {
+		templates, err := LoadTemplates(t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := ServerOptions{
+			ArticlesDir: t.TempDir(),
+			TemplatesDir: t.TempDir(),
+			StaticDir: t.TempDir(),
+			Timeouts: ServerTimeouts{Shutdown: shutdown},
+		}
+		return NewServer(newTestRepository(t), templates, opts)
+	}
+
+	t.Run("SIGHUP syncs articles", func(t *testing.T) {
+		server := newServer(t, time.Second)
+		signals := make(chan os.Signal, 1)
+		base, done := startTestServer(t, server, signals)
+
+		writeTestFiles(t, server.opts.ArticlesDir, map[string]string{"post.md": "# Post\n\nText\n"})
+		signals <- syscall.SIGHUP
+
+		status := 0
+		for i := 0; i < 100 && status != 200; i++ {
+			res, err := http.Get(base + "/article/post")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			status = res.StatusCode
+			time.Sleep(10 * time.Millisecond)
+		}
+		if status != 200 {
+			t.Errorf("article status %d after SIGHUP", status)
+		}
+
+		signals <- syscall.SIGTERM
+		waitForServer(t, done, 5 * time.Second)
+		if _, err := http.Get(base + "/"); err == nil {
+			t.Error("server still accepts requests")
+		}
+	})
+
+	t.Run("reload streams end", func(t *testing.T) {
+		server := newServer(t, 5 * time.Second)
+		server.reload = NewReloadBroker()
+		signals := make(chan os.Signal, 1)
+		base, done := startTestServer(t, server, signals)
+
+		res, err := http.Get(base + reloadPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		start := time.Now()
+		signals <- os.Interrupt
+		waitForServer(t, done, 5 * time.Second)
+		if elapsed := time.Since(start); elapsed > 2 * time.Second {
+			t.Errorf("shutdown waited %v for an event stream", elapsed)
+		}
+		if _, err := io.ReadAll(res.Body); err != nil {
+			t.Errorf("stream ended with %v", err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		shutdown := 200 * time.Millisecond
+		server := newServer(t, shutdown)
+		signals := make(chan os.Signal, 1)
+		base, done := startTestServer(t, server, signals)
+
+		// A request whose headers never finish keeps the connection active
+		conn, err := net.Dial("tcp", base[len("http://"):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "GET / HTTP/1.1\r\n")
+		time.Sleep(50 * time.Millisecond)
+
+		start := time.Now()
+		signals <- syscall.SIGTERM
+		waitForServer(t, done, 5 * time.Second)
+		if elapsed := time.Since(start); elapsed < shutdown {
+			t.Errorf("shutdown took %v, before the deadline of %v", elapsed, shutdown)
+		}
+
+		// The connection was closed at the deadline
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("read %v, want EOF", err)
+		}
+	})
+}
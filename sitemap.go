@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"fmt"
+	"time"
+	"strconv"
+	"net/url"
+	"encoding/xml"
+	"text/template"
+)
+
+// Limit of URLs in a single sitemap file set by the sitemap protocol
+const sitemapMaxURLs = 50000
+
+type SitemapOptions struct {
+	IndexPriority float64
+	ArticlePriority float64
+	TagPriority float64
+	ArchivePriority float64
+	// URLs per sitemap file, past it the sitemap is split into several files
+	// listed by a sitemap index
+	MaxURLs int
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+	Priority string `xml:"priority,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs []sitemapURL `xml:"url"`
+}
+
+type sitemapRef struct {
+	Loc string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func sitemapPriority(priority float64) string {
+	return strconv.FormatFloat(min(max(priority, 0), 1), 'f', 1, 64)
+}
+
+// Articles can override the default priority with sitemap_priority in their
+// front matter
+func articleSitemapPriority(article Article, fallback float64) float64 {
+	switch v := article.Extra["sitemap_priority"].(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return fallback
+}
+
+func sitemapPartName(n int) string {
+	return fmt.Sprintf("sitemap-%d.xml", n)
+}
+
+// Lists the index, archive, every article and every tag page
+func sitemapURLs(baseURL string, articles []Article, tags []TagCount, opts SitemapOptions) []sitemapURL {
+	var lastUpdate time.Time
+	for _, article := range articles {
+		if article.UpdatedAt.After(lastUpdate) {
+			lastUpdate = article.UpdatedAt
+		}
+	}
+
+	urls := make([]sitemapURL, 0, len(articles) + len(tags) + 3)
+	urls = append(urls, sitemapURL{
+		Loc: baseURL + "/",
+		LastMod: sitemapDate(lastUpdate),
+		Priority: sitemapPriority(opts.IndexPriority),
+	})
+
+	for _, article := range articles {
+		urls = append(urls, sitemapURL{
+			Loc: baseURL + "/article/" + url.PathEscape(article.Name),
+			LastMod: sitemapDate(article.UpdatedAt),
+			Priority: sitemapPriority(articleSitemapPriority(article, opts.ArticlePriority)),
+		})
+	}
+
+	if len(articles) > 0 {
+		urls = append(urls, sitemapURL{Loc: baseURL + "/archive", Priority: sitemapPriority(opts.ArchivePriority)})
+	}
+
+	if len(tags) > 0 {
+		urls = append(urls, sitemapURL{Loc: baseURL + "/tags", Priority: sitemapPriority(opts.TagPriority)})
+	}
+	for _, tag := range tags {
+		urls = append(urls, sitemapURL{
+			Loc: baseURL + tagURL(tag.Name),
+			Priority: sitemapPriority(opts.TagPriority),
+		})
+	}
+
+	return urls
+}
+
+// Builds the sitemap files by name. sitemap.xml is the whole sitemap, or when
+// there are too many URLs an index of sitemap-1.xml, sitemap-2.xml, ...
+func BuildSitemaps(baseURL string, articles []Article, tags []TagCount, opts SitemapOptions) (map[string][]byte, error) {
+	urls := sitemapURLs(baseURL, articles, tags, opts)
+	files := make(map[string][]byte)
+
+	limit := opts.MaxURLs
+	if limit <= 0 || limit > sitemapMaxURLs {
+		limit = sitemapMaxURLs
+	}
+
+	if len(urls) <= limit {
+		data, err := marshalXML(sitemapURLSet{URLs: urls})
+		if err != nil { return nil, err }
+		files["sitemap.xml"] = data
+		return files, nil
+	}
+
+	index := sitemapIndex{}
+	for n := 1; len(urls) > 0; n++ {
+		part := urls[:min(limit, len(urls))]
+		urls = urls[len(part):]
+
+		data, err := marshalXML(sitemapURLSet{URLs: part})
+		if err != nil { return nil, err }
+
+		var lastMod string
+		for _, u := range part {
+			lastMod = max(lastMod, u.LastMod)
+		}
+
+		name := sitemapPartName(n)
+		files[name] = data
+		index.Sitemaps = append(index.Sitemaps, sitemapRef{Loc: baseURL + "/" + name, LastMod: lastMod})
+	}
+
+	data, err := marshalXML(index)
+	if err != nil { return nil, err }
+	files["sitemap.xml"] = data
+
+	return files, nil
+}
+
+func RenderRobots(w io.Writer, tmpl *template.Template, baseURL string) error {
+	type templateData struct {
+		BaseURL string
+		SitemapURL string
+	}
+
+	data := templateData{
+		BaseURL: baseURL,
+		SitemapURL: baseURL + "/sitemap.xml",
+	}
+
+	return tmpl.Execute(w, data)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"time"
+	"slices"
+	"strings"
+	"testing"
+	"encoding/xml"
+	"path/filepath"
+	"net/http/httptest"
+)
+
+func testSitemapArticles() []Article {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	return []Article{
+		{Name: "new post", UpdatedAt: day(9), Extra: map[string]any{"sitemap_priority": 0.9}},
+		{Name: "old", UpdatedAt: day(2), Extra: map[string]any{"sitemap_priority": int64(3)}},
+		{Name: "plain", UpdatedAt: day(5)},
+	}
+}
+
+func TestBuildSitemaps(t *testing.T) {
+	opts := SitemapOptions{IndexPriority: 1, ArticlePriority: 0.5, TagPriority: 0.25, ArchivePriority: -1}
+	tags := []TagCount{{Name: "go", Count: 2}}
+
+	tests := []struct {
+		name string
+		maxURLs int
+		files []string
+	}{
+		{"single file", 0, []string{"sitemap.xml"}},
+		{"limit above the protocol", sitemapMaxURLs + 1, []string{"sitemap.xml"}},
+		{"split", 3, []string{"sitemap-1.xml", "sitemap-2.xml", "sitemap-3.xml", "sitemap.xml"}},
+	}
+
+	// Every URL in order with its priority and last modification
+	wantURLs := []string{
+		"https://example.com/ 1.0 2024-03-09T00:00:00Z",
+		"https://example.com/article/new%20post 0.9 2024-03-09T00:00:00Z",
+		"https://example.com/article/old 1.0 2024-03-02T00:00:00Z",
+		"https://example.com/article/plain 0.5 2024-03-05T00:00:00Z",
+		"https://example.com/archive 0.0 ",
+		"https://example.com/tags 0.2 ",
+		"https://example.com/tag/go 0.2 ",
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := opts
+			opts.MaxURLs = test.maxURLs
+			files, err := BuildSitemaps("https://example.com", testSitemapArticles(), tags, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, 0, len(files))
+			for name := range files {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, test.files) {
+				t.Fatalf("files %v, want %v", names, test.files)
+			}
+
+			parts := []string{"sitemap.xml"}
+			if len(files) > 1 {
+				index := sitemapIndex{}
+				if err := xml.Unmarshal(files["sitemap.xml"], &index); err != nil {
+					t.Fatal(err)
+				}
+				parts = parts[:0]
+				for _, ref := range index.Sitemaps {
+					parts = append(parts, strings.TrimPrefix(ref.Loc, "https://example.com/"))
+				}
+				if index.Sitemaps[0].LastMod != "2024-03-09T00:00:00Z" || index.Sitemaps[2].LastMod != "" {
+					t.Errorf("index %+v", index.Sitemaps)
+				}
+			}
+
+			urls := make([]string, 0, len(wantURLs))
+			for _, part := range parts {
+				set := sitemapURLSet{}
+				if err := xml.Unmarshal(files[part], &set); err != nil {
+					t.Fatalf("%s: %v", part, err)
+				}
+				if test.maxURLs > 0 && len(set.URLs) > test.maxURLs {
+					t.Errorf("%s has %d URLs", part, len(set.URLs))
+				}
+				for _, u := range set.URLs {
+					urls = append(urls, u.Loc + " " + u.Priority + " " + u.LastMod)
+				}
+			}
+			if !slices.Equal(urls, wantURLs) {
+				t.Errorf("urls\n%s\nwant\n%s", strings.Join(urls, "\n"), strings.Join(wantURLs, "\n"))
+			}
+		})
+	}
+
+	files, err := BuildSitemaps("https://example.com", nil, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := sitemapURLSet{}
+	if err := xml.Unmarshal(files["sitemap.xml"], &set); err != nil || len(set.URLs) != 1 || set.URLs[0].LastMod != "" {
+		t.Errorf("empty site sitemap %+v (%v)", set, err)
+	}
+}
+
+func TestSitemapEndpoints(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "post", "---\ntitle: Post\ndate: 2024-03-05\ntags: [go]\n---\nText\n")
+	createTestArticle(t, repo, "draft", "---\ntitle: Draft\ndraft: true\n---\nText\n")
+	handler := newTestServer(t, repo, ServerOptions{Feed: FeedOptions{BaseURL: "https://example.com"}})
+
+	tests := []struct {
+		path string
+		status int
+		contains []string
+		missing []string
+	}{
+		{"/sitemap.xml", 200, []string{"<loc>https://example.com/article/post</loc>", "<loc>https://example.com/tag/go</loc>"}, []string{"draft"}},
+		{"/sitemap-1.xml", 404, nil, nil},
+		{"/robots.txt", 200, []string{"Sitemap: https://example.com/sitemap.xml"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+			if rec.Code != test.status {
+				t.Fatalf("status %d, want %d", rec.Code, test.status)
+			}
+			for _, s := range test.contains {
+				if !strings.Contains(rec.Body.String(), s) {
+					t.Errorf("missing %s in\n%s", s, rec.Body.String())
+				}
+			}
+			for _, s := range test.missing {
+				if strings.Contains(rec.Body.String(), s) {
+					t.Errorf("unexpected %s in\n%s", s, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// A static build writes the same sitemap and robots.txt
+func TestBuildSiteSitemap(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "post", "---\ntitle: Post\ndate: 2024-03-05\n---\nText\n")
+	templates, err := LoadTemplates(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	opts := ServerOptions{
+		Feed: FeedOptions{BaseURL: "https://example.com"},
+		ArticlesDir: t.TempDir(),
+		TemplatesDir: t.TempDir(),
+		StaticDir: t.TempDir(),
+	}
+	if err := BuildSite(outDir, false, repo, templates, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"sitemap.xml": "<loc>https://example.com/article/post</loc>",
+		"robots.txt": "Sitemap: https://example.com/sitemap.xml",
+	}
+	for name, want := range files {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s is missing %s", name, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"encoding/json"
+	"text/tabwriter"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+const wordsPerMinute = 200
+
+type ArticleStats struct {
+	WordCount int
+	ReadingMinutes int
+	CodeBlocks int
+	Images int
+}
+
+// Counts the prose words, code blocks and images of an article body
+func ComputeArticleStats(root ast.Node) ArticleStats {
+	stats := ArticleStats{}
+	// Inline markup splits words into several text nodes, so the text is
+	// joined before counting
+	text := strings.Builder{}
+
+	ast.WalkFunc(root, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			switch node.(type) {
+			case *ast.Emph, *ast.Strong, *ast.Del, *ast.Link:
+			default:
+				text.WriteByte(' ')
+			}
+			return ast.GoToNext
+		}
+
+		switch node := node.(type) {
+		case *ast.CodeBlock:
+			stats.CodeBlocks += 1
+		case *ast.Image:
+			stats.Images += 1
+			text.WriteByte(' ')
+			return ast.SkipChildren
+		case *ast.Math, *ast.MathBlock, *ast.HTMLBlock, *ast.HTMLSpan, *ast.Hardbreak:
+			text.WriteByte(' ')
+			return ast.SkipChildren
+		case *ast.Text:
+			text.Write(node.Literal)
+		case *ast.Code:
+			text.Write(node.Literal)
+		}
+		return ast.GoToNext
+	})
+
+	stats.WordCount = len(strings.Fields(text.String()))
+	stats.ReadingMinutes = int(math.Ceil(float64(stats.WordCount) / wordsPerMinute))
+	return stats
+}
+
+func (stats *ArticleStats) Add(other ArticleStats) {
+	stats.WordCount += other.WordCount
+	stats.ReadingMinutes += other.ReadingMinutes
+	stats.CodeBlocks += other.CodeBlocks
+	stats.Images += other.Images
+}
+
+type articleStatsRow struct {
+	Name string `json:"name"`
+	Title string `json:"title"`
+	Words int `json:"words"`
+	ReadingMinutes int `json:"reading_minutes"`
+	CodeBlocks int `json:"code_blocks"`
+	Images int `json:"images"`
+}
+
+func newArticleStatsRow(name string, title string, stats ArticleStats) articleStatsRow {
+	return articleStatsRow{
+		Name: name,
+		Title: title,
+		Words: stats.WordCount,
+		ReadingMinutes: stats.ReadingMinutes,
+		CodeBlocks: stats.CodeBlocks,
+		Images: stats.Images,
+	}
+}
+
+// Prints the statistics of every article that was not archived and their
+// totals, either as a table or as JSON
+func PrintStats(w io.Writer, articles []Article, asJSON bool) error {
+	rows := make([]articleStatsRow, 0, len(articles))
+	total := ArticleStats{}
+
+	for _, article := range sortArticlesNewestFirst(articles) {
+		if article.Deleted {
+			continue
+		}
+		rows = append(rows, newArticleStatsRow(article.Name, article.RawTitle, article.ArticleStats))
+		total.Add(article.ArticleStats)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Articles []articleStatsRow `json:"articles"`
+			Total articleStatsRow `json:"total"`
+		}{rows, newArticleStatsRow("", "", total)})
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "words\tminutes\tcode\timages\t\tarticle")
+	for _, row := range rows {
+		fmt.Fprintf(table, "%d\t%d\t%d\t%d\t\t%s\n", row.Words, row.ReadingMinutes, row.CodeBlocks, row.Images, row.Name)
+	}
+	fmt.Fprintf(table, "%d\t%d\t%d\t%d\t\t%s\n", total.WordCount, total.ReadingMinutes, total.CodeBlocks, total.Images,
+		fmt.Sprintf("total (%d articles)", len(rows)))
+	return table.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"encoding/json"
+)
+
+func TestComputeArticleStats(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		want ArticleStats
+	}{
+		{"empty", "", ArticleStats{}},
+		{"prose", "One two *three* [four](x).\n\n- five\n- six\n", ArticleStats{WordCount: 6, ReadingMinutes: 1}},
+		{"split by markup", "un*believ*able foo_bar_ a  \nb\n", ArticleStats{WordCount: 4, ReadingMinutes: 1}},
+		{"inline code", "Call `go vet ./...` now\n", ArticleStats{WordCount: 5, ReadingMinutes: 1}},
+		{"code block", "```go\nfunc main() {}\n```\n\n    indented\n", ArticleStats{CodeBlocks: 2}},
+		{"images", "![alt text here](a.png) and ![b](b.png)\n", ArticleStats{WordCount: 1, ReadingMinutes: 1, Images: 2}},
+		{"math and html", "Euler $e^{i \\pi} + 1 = 0$\n\n<div>not counted</div>\n", ArticleStats{WordCount: 1, ReadingMinutes: 1}},
+		{"reading time", strings.Repeat("word ", 401), ArticleStats{WordCount: 401, ReadingMinutes: 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("stats", "---\ntitle: Not counted\n---\n" + test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if article.ArticleStats != test.want {
+				t.Errorf("stats %+v, want %+v", article.ArticleStats, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestArticle(t, repo, "first", "---\ntitle: First\ndate: 2024-03-01\n---\nOne two three\n\n```\ncode\n```\n")
+	createTestArticle(t, repo, "second", "---\ntitle: Second\ndate: 2024-03-02\n---\nFour five ![x](x.png)\n")
+	archived := createTestArticle(t, repo, "archived", "---\ntitle: Archived\n---\nSix seven eight\n")
+	if err := repo.ArchiveArticle(archived); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statistics are stored with the article
+	stored, err := repo.GetArticleByName("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ArticleStats{WordCount: 3, ReadingMinutes: 1, CodeBlocks: 1}); stored.ArticleStats != want {
+		t.Errorf("stored stats %+v, want %+v", stored.ArticleStats, want)
+	}
+
+	articles, err := repo.ListArticles(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := strings.Builder{}
+	if err := PrintStats(&out, articles, true); err != nil {
+		t.Fatal(err)
+	}
+	report := struct {
+		Articles []articleStatsRow `json:"articles"`
+		Total articleStatsRow `json:"total"`
+	}{}
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatalf("%v in %s", err, out.String())
+	}
+
+	if len(report.Articles) != 2 || report.Articles[0].Name != "second" || report.Articles[1].Name != "first" {
+		t.Errorf("articles %+v, want second and first", report.Articles)
+	}
+	if want := newArticleStatsRow("", "", ArticleStats{WordCount: 5, ReadingMinutes: 2, CodeBlocks: 1, Images: 1}); report.Total != want {
+		t.Errorf("total %+v, want %+v", report.Total, want)
+	}
+
+	out.Reset()
+	if err := PrintStats(&out, articles, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[3], "total (2 articles)") || strings.Contains(out.String(), "archived") {
+		t.Errorf("table\n%s", out.String())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"html/template"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// Content before this marker is the summary of an article
+const moreMarker = "<!--more-->"
+
+// Length of summaries of articles without a marker or description
+const summaryWords = 50
+
+// Summary shown in article lists and feeds. Uses the description if there is
+// one, otherwise everything before a <!--more--> line or the first words of
+// the article.
+func BuildSummary(root *ast.Document, md MarkdownOptions, description string, text string) HTML {
+	if description != "" {
+		return template.HTML("<p>" + template.HTMLEscapeString(description) + "</p>")
+	}
+
+	for i, child := range root.Children {
+		block, ok := child.(*ast.HTMLBlock)
+		if !ok || strings.TrimSpace(string(block.Literal)) != moreMarker {
+			continue
+		}
+
+		intro := ast.Document{}
+		intro.Children = make([]ast.Node, 0, i)
+		for _, node := range root.Children[:i] {
+			// The table of contents belongs to the article page
+			if _, ok := node.(*tocNode); !ok {
+				intro.Children = append(intro.Children, node)
+			}
+		}
+		return template.HTML(markdown.Render(&intro, md.summaryRenderer()))
+	}
+
+	if words := TruncateWords(text, summaryWords); words != "" {
+		return template.HTML("<p>" + template.HTMLEscapeString(words) + "</p>")
+	}
+	return ""
+}
+
+// Renders the intro on its own. The renderer of the article has already seen
+// its headings and would suffix their IDs, and footnote references are
+// dropped as the footnotes are not part of the summary.
+func (md MarkdownOptions) summaryRenderer() *html.Renderer {
+	opts := md.rendererOptions()
+	opts.RenderNodeHook = func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		if link, ok := node.(*ast.Link); ok && link.NoteID != 0 {
+			return ast.SkipChildren, true
+		}
+		return md.renderHook(w, node, entering)
+	}
+	return html.NewRenderer(opts)
+}
+
+func TruncateWords(text string, words int) string {
+	fields := strings.Fields(text)
+	if words > 0 && len(fields) > words {
+		return strings.Join(fields[:words], " ") + "…"
+	}
+	return strings.Join(fields, " ")
+}
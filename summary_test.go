@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		want string
+		// Must not appear in the summary
+		unwanted []string
+	}{
+		{
+			name: "description",
+			source: "---\ndescription: About <things>\n---\nText\n",
+			want: "<p>About &lt;things&gt;</p>",
+		},
+		{
+			name: "first words",
+			source: "# Title\n\n" + strings.Repeat("word ", 60) + "\n",
+			want: "<p>" + strings.TrimSpace(strings.Repeat("word ", 50)) + "…</p>",
+		},
+		{
+			name: "more marker",
+			source: "# Title\n\nIntro *text*.\n\n<!--more-->\n\nRest\n",
+			want: "<p>Intro <em>text</em>.</p>\n",
+		},
+		{
+			name: "heading IDs of the intro",
+			source: "# Title\n\n## A\n\nIntro\n\n<!--more-->\n\n## B\n",
+			want: "<h2 id=\"a\">A</h2>\n\n<p>Intro</p>\n",
+		},
+		{
+			name: "table of contents",
+			source: "# Title\n\n[[toc]]\n\nIntro\n\n<!--more-->\n\n## A\n\nText\n",
+			want: "<p>Intro</p>\n",
+			unwanted: []string{`class="toc"`},
+		},
+		{
+			name: "footnote references",
+			source: "# Title\n\nIntro[^1] text.\n\n<!--more-->\n\nRest\n\n[^1]: Note\n",
+			want: "<p>Intro text.</p>\n",
+			unwanted: []string{"footnote", "Note"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("summary", test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			summary := string(article.Summary)
+			if summary != test.want {
+				t.Errorf("summary %q, want %q", summary, test.want)
+			}
+			for _, s := range test.unwanted {
+				if strings.Contains(summary, s) {
+					t.Errorf("summary contains %q: %s", s, summary)
+				}
+			}
+		})
+	}
+}
+
+// The summary is rendered after the article, which must keep its own heading
+// IDs and footnotes
+func TestBuildSummaryLeavesArticle(t *testing.T) {
+	source := "# Title\n\n[[toc]]\n\n## A\n\nIntro[^1].\n\n<!--more-->\n\n## A\n\nRest\n\n[^1]: Note\n"
+	article, err := ArticleFromMarkdown("summary", source, DefaultMarkdownOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := string(article.Content)
+	for _, s := range []string{`id="a"`, `id="a-1"`, `class="toc"`, `class="footnote-ref"`, "Note"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("content is missing %q: %s", s, content)
+		}
+	}
+	if strings.Contains(string(article.Summary), `id="a-1"`) {
+		t.Errorf("summary has a suffixed heading ID: %s", article.Summary)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"io"
+	"errors"
+	"database/sql"
+	"path/filepath"
+)
+
+// What happens to articles whose source file is gone
+type RemovalPolicy string
+
+const (
+	RemovalKeep RemovalPolicy = "keep"
+	// Hide the article, its URL answers with 410 Gone
+	RemovalArchive RemovalPolicy = "archive"
+	RemovalDelete RemovalPolicy = "delete"
+)
+
+func ParseRemovalPolicy(s string) (RemovalPolicy, error) {
+	switch policy := RemovalPolicy(s); policy {
+	case RemovalKeep, RemovalArchive, RemovalDelete:
+		return policy, nil
+	case "":
+		return RemovalArchive, nil
+	}
+	return "", fmt.Errorf("unknown removal policy %q, expected keep, archive or delete", s)
+}
+
+type SyncOptions struct {
+	Removal RemovalPolicy
+	// Only report what would change
+	DryRun bool
+	Markdown MarkdownOptions
+}
+
+type SyncReport struct {
+	Created []string
+	Updated []string
+	Archived []string
+	Deleted []string
+	Failed []string
+}
+
+// Whether any article was written to the database
+func (report SyncReport) Changed() bool {
+	return len(report.Created) + len(report.Updated) + len(report.Archived) + len(report.Deleted) > 0
+}
+
+func (report SyncReport) Print(w io.Writer) {
+	sections := []struct {
+		action string
+		names []string
+	}{
+		{"create", report.Created},
+		{"update", report.Updated},
+		{"archive", report.Archived},
+		{"delete", report.Deleted},
+		{"failed", report.Failed},
+	}
+
+	total := 0
+	for _, section := range sections {
+		for _, name := range section.names {
+			fmt.Fprintf(w, "%-8s %s\n", section.action, name)
+			total += 1
+		}
+	}
+
+	if total == 0 {
+		fmt.Fprintln(w, "Everything up to date")
+	}
+}
+
+// Brings the database in line with the markdown files in dir
+func SyncArticles(dir string, repo *Repository, opts SyncOptions) (SyncReport, error) {
+	report := SyncReport{}
+
+	files, err := ListDirectoryMarkdownFiles(dir)
+	if err != nil { return report, err }
+
+	// Name each source file currently produces
+	names := make(map[string]string, len(files))
+
+	for _, file := range files {
+		article, err := SyncArticleFile(file, repo, opts, &report)
+		if err != nil {
+			log.Println("Failed to sync article:", err.Error())
+			report.Failed = append(report.Failed, filepath.Base(file))
+			continue
+		}
+		names[article.Source] = article.Name
+	}
+
+	err = RemoveOrphanedArticles(dir, names, repo, opts, &report)
+	return report, err
+}
+
+// Creates or updates the article stored in a markdown file, articles whose
+// source did not change are left alone.
+func SyncArticleFile(path string, repo *Repository, opts SyncOptions, report *SyncReport) (Article, error) {
+	article, err := LoadArticleFromFile(path, opts.Markdown)
+	if err != nil { return article, err }
+
+	if dbArticle, err := repo.GetArticleByName(article.Name); err == nil {
+		if dbArticle.Hash == article.Hash && dbArticle.Source == article.Source && !dbArticle.Deleted {
+			return article, nil
+		}
+
+		report.Updated = append(report.Updated, article.Name)
+		if opts.DryRun {
+			return article, nil
+		}
+		log.Println("Update", article.Name)
+
+		article.Id = dbArticle.Id
+		return article, repo.UpdateArticle(article)
+
+	} else if errors.Is(err, sql.ErrNoRows) {
+		report.Created = append(report.Created, article.Name)
+		if opts.DryRun {
+			return article, nil
+		}
+		log.Println("Create", article.Name)
+
+		article.Id, err = repo.CreateArticle(article)
+		return article, err
+
+	} else {
+		return article, err
+	}
+}
+
+// Applies the removal policy to articles whose source file no longer exists
+// in dir, or now produces an article with a different name. names maps source
+// files to the names they produced, files missing from it are checked on disk.
+func RemoveOrphanedArticles(dir string, names map[string]string, repo *Repository, opts SyncOptions, report *SyncReport) error {
+	if opts.Removal == RemovalKeep {
+		return nil
+	}
+
+	articles, err := repo.ListArticles(ListOptions{})
+	if err != nil { return err }
+
+	for _, article := range articles {
+		if article.Deleted && opts.Removal == RemovalArchive {
+			continue
+		}
+
+		source := article.Source
+		if source == "" {
+			source = article.Name + ".md"
+		}
+
+		if name, ok := names[source]; ok {
+			if name == article.Name {
+				continue
+			}
+		} else if _, err := os.Stat(filepath.Join(dir, source)); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		switch opts.Removal {
+		case RemovalArchive:
+			report.Archived = append(report.Archived, article.Name)
+			if !opts.DryRun {
+				log.Println("Archive", article.Name)
+				err = repo.ArchiveArticle(article)
+			}
+		case RemovalDelete:
+			report.Deleted = append(report.Deleted, article.Name)
+			if !opts.DryRun {
+				log.Println("Delete", article.Name)
+				err = repo.DeleteArticle(article)
+			}
+		}
+
+		if err != nil { return err }
+	}
+
+	return nil
+}
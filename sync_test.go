@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+func TestSyncRemoval(t *testing.T) {
+	tests := []struct {
+		policy RemovalPolicy
+		dryRun bool
+		archived []string
+		deleted []string
+		// Status of the removed article and of the old name of the renamed one
+		status int
+	}{
+		{RemovalKeep, false, nil, nil, 200},
+		{RemovalArchive, false, []string{"old-name", "removed"}, nil, 410},
+		{RemovalArchive, true, []string{"old-name", "removed"}, nil, 200},
+		{RemovalDelete, false, nil, []string{"old-name", "removed"}, 404},
+		{RemovalDelete, true, nil, []string{"old-name", "removed"}, 200},
+	}
+
+	for _, test := range tests {
+		name := string(test.policy)
+		if test.dryRun {
+			name += " dry run"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{
+				"kept.md": "---\ntitle: Kept\ndate: 2024-01-01\n---\nText\n",
+				"removed.md": "---\ntitle: Removed\ndate: 2024-01-02\n---\nText\n",
+				"renamed.md": "---\ntitle: Renamed\nslug: old-name\ndate: 2024-01-03\n---\nText\n",
+			})
+
+			report, err := SyncArticles(dir, repo, SyncOptions{Removal: test.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Created) != 3 {
+				t.Fatalf("created %v, want 3 articles", report.Created)
+			}
+
+			if err := os.Remove(filepath.Join(dir, "removed.md")); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFiles(t, dir, map[string]string{
+				"renamed.md": "---\ntitle: Renamed\nslug: new-name\ndate: 2024-01-03\n---\nText\n",
+			})
+
+			report, err = SyncArticles(dir, repo, SyncOptions{Removal: test.policy, DryRun: test.dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(report.Archived)
+			slices.Sort(report.Deleted)
+			if !slices.Equal(report.Archived, test.archived) || !slices.Equal(report.Deleted, test.deleted) {
+				t.Errorf("archived %v and deleted %v, want %v and %v", report.Archived, report.Deleted, test.archived, test.deleted)
+			}
+
+			handler := newTestServer(t, repo, ServerOptions{})
+			statuses := map[string]int{
+				"/article/kept": 200,
+				"/article/removed": test.status,
+				"/article/old-name": test.status,
+			}
+			if !test.dryRun {
+				statuses["/article/new-name"] = 200
+			}
+			for path, want := range statuses {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+				if rec.Code != want {
+					t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+				}
+			}
+
+			// A second sync finds nothing left to remove
+			if !test.dryRun {
+				report, err = SyncArticles(dir, repo, SyncOptions{Removal: test.policy})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if report.Changed() {
+					t.Errorf("second sync changed %+v", report)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncRestoresArchivedArticle(t *testing.T) {
+	repo := newTestRepository(t)
+	dir := t.TempDir()
+	source := "---\ntitle: Back\ndate: 2024-01-01\n---\nText\n"
+	writeTestFiles(t, dir, map[string]string{"back.md": source})
+
+	opts := SyncOptions{Removal: RemovalArchive}
+	if _, err := SyncArticles(dir, repo, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "back.md")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SyncArticles(dir, repo, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFiles(t, dir, map[string]string{"back.md": source})
+	report, err := SyncArticles(dir, repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Updated, []string{"back"}) {
+		t.Errorf("updated %v, want [back]", report.Updated)
+	}
+
+	rec := httptest.NewRecorder()
+	newTestServer(t, repo, ServerOptions{}).ServeHTTP(rec, httptest.NewRequest("GET", "/article/back", nil))
+	if rec.Code != 200 {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"database/sql/driver"
+	"encoding/json"
+	"html/template"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Heading levels included in the table of contents, counted from the highest
+// heading in the body. Articles can override it with toc_depth.
+const DefaultTOCDepth = 3
+
+const tocMarker = "[[toc]]"
+
+type TOCEntry struct {
+	Id string
+	Text string
+	Children []TOCEntry `json:",omitempty"`
+}
+
+type TableOfContents struct {
+	Entries []TOCEntry
+	// Placed in the body with a [[toc]] marker
+	Inline bool
+}
+
+func (toc TableOfContents) Value() (driver.Value, error) {
+	data, err := json.Marshal(toc)
+	return string(data), err
+}
+
+func (toc *TableOfContents) Scan(src any) error {
+	return scanJSON(src, toc)
+}
+
+func (toc TableOfContents) HTML() HTML {
+	if len(toc.Entries) == 0 {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`<nav class="toc">`)
+	writeTOCEntries(&sb, toc.Entries)
+	sb.WriteString("</nav>\n")
+	return template.HTML(sb.String())
+}
+
+func writeTOCEntries(sb *strings.Builder, entries []TOCEntry) {
+	sb.WriteString("<ul>")
+	for _, entry := range entries {
+		sb.WriteString(`<li><a href="#` + template.HTMLEscapeString(entry.Id) + `">`)
+		sb.WriteString(template.HTMLEscapeString(entry.Text))
+		sb.WriteString("</a>")
+		if len(entry.Children) > 0 {
+			writeTOCEntries(sb, entry.Children)
+		}
+		sb.WriteString("</li>")
+	}
+	sb.WriteString("</ul>")
+}
+
+// Nests the headings of doc by level, skipping headings more than depth
+// levels below the highest one.
+func BuildTableOfContents(doc ast.Node, depth int) TableOfContents {
+	toc := TableOfContents{}
+	if depth <= 0 {
+		return toc
+	}
+
+	headings := make([]*ast.Heading, 0, 16)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering && heading.HeadingID != "" && !heading.IsTitleblock {
+			headings = append(headings, heading)
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+
+	if len(headings) == 0 {
+		return toc
+	}
+
+	top := headings[0].Level
+	for _, heading := range headings {
+		top = min(top, heading.Level)
+	}
+
+	for _, heading := range headings {
+		level := heading.Level - top
+		if level >= depth {
+			continue
+		}
+
+		// Descend into the last entry of each level, a heading that skips
+		// levels is attached to the deepest existing one
+		entries := &toc.Entries
+		for ; level > 0 && len(*entries) > 0; level-- {
+			entries = &(*entries)[len(*entries) - 1].Children
+		}
+
+		*entries = append(*entries, TOCEntry{
+			Id: heading.HeadingID,
+			Text: strings.Join(strings.Fields(ExtractRawText(heading)), " "),
+		})
+	}
+
+	return toc
+}
+
+// Stands in for a [[toc]] paragraph until rendering
+type tocNode struct {
+	ast.Leaf
+	TOC *TableOfContents
+}
+
+// Replaces [[toc]] paragraphs with the table of contents, returns whether
+// there were any.
+func ReplaceTOCMarkers(doc *ast.Document, toc *TableOfContents) bool {
+	found := false
+
+	for i, child := range doc.Children {
+		paragraph, ok := child.(*ast.Paragraph)
+		if !ok || strings.TrimSpace(paragraphText(paragraph)) != tocMarker {
+			continue
+		}
+
+		node := &tocNode{TOC: toc}
+		node.Parent = doc
+		doc.Children[i] = node
+		found = true
+	}
+
+	return found
+}
+
+// Text of a paragraph made only of text nodes, the parser may split brackets
+// into separate nodes
+func paragraphText(paragraph *ast.Paragraph) string {
+	sb := strings.Builder{}
+	for _, child := range paragraph.Children {
+		text, ok := child.(*ast.Text)
+		if !ok {
+			return ""
+		}
+		sb.Write(text.Literal)
+	}
+	return sb.String()
+}
+
+func renderTOCNode(w io.Writer, node *tocNode) (ast.WalkStatus, bool) {
+	io.WriteString(w, string(node.TOC.HTML()))
+	return ast.GoToNext, true
+}
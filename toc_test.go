@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Writes entries as "id(children) id", which keeps the nesting readable
+func formatTOCEntries(entries []TOCEntry) string {
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if len(entry.Children) > 0 {
+			parts = append(parts, entry.Id + "(" + formatTOCEntries(entry.Children) + ")")
+		} else {
+			parts = append(parts, entry.Id)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildTableOfContents(t *testing.T) {
+	tests := []struct {
+		name string
+		source string
+		want string
+		inline bool
+	}{
+		{
+			name: "nested",
+			source: "---\ntitle: T\n---\n## a\n### b\n#### c\n### d\n## e\n",
+			want: "a(b(c) d) e",
+		},
+		{
+			name: "skipped level",
+			source: "---\ntitle: T\n---\n## a\n#### b\n### c\n",
+			want: "a(b c)",
+		},
+		{
+			name: "deeper before higher",
+			source: "---\ntitle: T\n---\n### a\n## b\n### c\n",
+			want: "a b(c)",
+		},
+		{
+			name: "default depth",
+			source: "---\ntitle: T\n---\n## a\n### b\n#### c\n##### d\n",
+			want: "a(b(c))",
+		},
+		{
+			name: "toc_depth",
+			source: "---\ntitle: T\ntoc_depth: 1\n---\n## a\n### b\n## c\n",
+			want: "a c",
+		},
+		{
+			name: "disabled",
+			source: "---\ntitle: T\ntoc_depth: 0\n---\n## a\n",
+			want: "",
+		},
+		{
+			name: "title heading left out",
+			source: "# Title\n## a\n",
+			want: "a",
+		},
+		{
+			name: "inline marker",
+			source: "---\ntitle: T\n---\nIntro\n\n[[toc]]\n\n## a\n",
+			want: "a",
+			inline: true,
+		},
+		{
+			name: "marker in text",
+			source: "---\ntitle: T\n---\nWrite [[toc]] to place it\n\n## a\n",
+			want: "a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := ArticleFromMarkdown("toc", test.source, DefaultMarkdownOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := formatTOCEntries(article.TOC.Entries); got != test.want {
+				t.Errorf("entries %q, want %q", got, test.want)
+			}
+			if article.TOC.Inline != test.inline {
+				t.Errorf("inline %v, want %v", article.TOC.Inline, test.inline)
+			}
+			if nav := strings.Contains(string(article.Content), `<nav class="toc">`); nav != test.inline {
+				t.Errorf("content has the table of contents: %v\n%s", nav, article.Content)
+			}
+		})
+	}
+}
+
+func TestTableOfContentsHTML(t *testing.T) {
+	toc := TableOfContents{Entries: []TOCEntry{
+		{Id: "a", Text: "Fish & <chips>", Children: []TOCEntry{{Id: "b", Text: "B"}}},
+		{Id: "c", Text: "C"},
+	}}
+	want := `<nav class="toc"><ul><li><a href="#a">Fish &amp; &lt;chips&gt;</a><ul><li><a href="#b">B</a></li></ul></li><li><a href="#c">C</a></li></ul></nav>` + "\n"
+
+	if got := toc.HTML(); string(got) != want {
+		t.Errorf("HTML\n%s\nwant\n%s", got, want)
+	}
+	if got := (TableOfContents{}).HTML(); got != "" {
+		t.Errorf("empty table of contents rendered as %s", got)
+	}
+
+	value, err := toc.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned := TableOfContents{}
+	if err := scanned.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if scanned.HTML() != toc.HTML() {
+		t.Errorf("scanned table of contents renders as %s", scanned.HTML())
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+	"io/fs"
+	"strings"
+	"path/filepath"
+)
+
+const watchDebounce = 100 * time.Millisecond
+
+type fileState struct {
+	ModTime time.Time
+	Size int64
+}
+
+// Watches dirs recursively and sends batches of changed paths. inotify is used
+// where available, otherwise the directories are polled every interval.
+func WatchDirectories(dirs []string, interval time.Duration) <-chan []string {
+	changes := make(chan string, 64)
+	batches := make(chan []string)
+
+	err := watchNotify(dirs, changes)
+	if err != nil {
+		log.Println("File notifications unavailable, polling instead:", err.Error())
+		go pollDirectories(dirs, interval, changes)
+	}
+
+	go debounceChanges(changes, batches)
+	return batches
+}
+
+// Groups changes that arrive close together, editors tend to touch a file
+// several times when saving.
+func debounceChanges(changes <-chan string, batches chan<- []string) {
+	for path := range changes {
+		batch := []string{path}
+		timer := time.NewTimer(watchDebounce)
+
+	collect:
+		for {
+			select {
+			case path := <-changes:
+				batch = append(batch, path)
+			case <-timer.C:
+				break collect
+			}
+		}
+
+		batches <- uniqueStrings(batch)
+	}
+}
+
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	result := make([]string, 0, len(s))
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func snapshotDirectories(dirs []string) map[string]fileState {
+	snapshot := make(map[string]fileState)
+
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				snapshot[path] = fileState{ModTime: info.ModTime(), Size: info.Size()}
+			}
+			return nil
+		})
+	}
+
+	return snapshot
+}
+
+func pollDirectories(dirs []string, interval time.Duration, changes chan<- string) {
+	previous := snapshotDirectories(dirs)
+
+	for {
+		time.Sleep(interval)
+		current := snapshotDirectories(dirs)
+
+		for path, state := range current {
+			if old, ok := previous[path]; !ok || old != state {
+				changes <- path
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				changes <- path
+			}
+		}
+
+		previous = current
+	}
+}
+
+func isInDir(path string, dir string) bool {
+	return strings.HasPrefix(filepath.Clean(path), filepath.Clean(dir) + string(filepath.Separator))
+}
+
+// Keeps the database, templates and open pages in sync with the files on disk
+func (server *Server) Watch() {
+	articleDir, templateDir, staticDir := server.opts.ArticlesDir, server.opts.TemplatesDir, server.opts.StaticDir
+
+	log.Println("Watching for changes")
+
+	for batch := range WatchDirectories([]string{articleDir, templateDir, staticDir}, time.Second) {
+		changed := false
+		reloadTemplates := false
+		reloadAssets := false
+
+		for _, path := range batch {
+			switch {
+			case isInDir(path, articleDir) && strings.HasSuffix(path, ".md"):
+				report := SyncReport{}
+				names := make(map[string]string)
+
+				if _, err := os.Stat(path); err == nil {
+					article, err := SyncArticleFile(path, server.repo, server.opts.Sync, &report)
+					if err != nil {
+						log.Println("Failed to sync article:", err.Error())
+						continue
+					}
+					names[article.Source] = article.Name
+				}
+
+				// Catches both removed files and articles that changed their slug
+				err := RemoveOrphanedArticles(articleDir, names, server.repo, server.opts.Sync, &report)
+				if err != nil {
+					log.Println("Failed to remove articles:", err.Error())
+				}
+				if report.Changed() {
+					server.pages.Invalidate()
+				}
+				changed = true
+
+			case isInDir(path, templateDir):
+				reloadTemplates = true
+
+			case isInDir(path, staticDir):
+				reloadAssets = true
+			}
+		}
+
+		assets := server.Templates().Assets
+		if reloadAssets {
+			var err error
+			assets, err = LoadAssets(staticDir, assets)
+			if err != nil {
+				log.Println("Failed to reload static assets:", err.Error())
+				continue
+			}
+			log.Println("Reload static assets")
+			reloadTemplates = true
+		}
+
+		if reloadTemplates {
+			templates, err := LoadTemplates(templateDir, assets)
+			if err != nil {
+				log.Println("Failed to reload templates:", err.Error())
+				continue
+			}
+			log.Println("Reload templates")
+			server.SetTemplates(templates)
+			changed = true
+		}
+
+		if changed {
+			server.reload.Notify()
+		}
+	}
+}
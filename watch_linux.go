@@ -0,0 +1,87 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"io/fs"
+	"bytes"
+	"syscall"
+	"path/filepath"
+	"encoding/binary"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MODIFY | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Size of the fixed part of struct inotify_event, the file name follows it
+const inotifyEventSize = 16
+
+func watchNotify(dirs []string, changes chan<- string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil { return err }
+
+	watches := make(map[int32]string)
+
+	addWatch := func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.IsDir() {
+				return nil
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil { return err }
+			watches[int32(wd)] = path
+			return nil
+		})
+	}
+
+	for _, dir := range dirs {
+		err := addWatch(dir)
+		if err != nil {
+			syscall.Close(fd)
+			return err
+		}
+	}
+
+	go func(){
+		defer syscall.Close(fd)
+		buf := make([]byte, 64 * 1024)
+
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			} else if err != nil {
+				log.Println("Failed to read file notifications:", err.Error())
+				return
+			}
+
+			for offset := 0; offset + inotifyEventSize <= n; {
+				wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+				mask := binary.NativeEndian.Uint32(buf[offset + 4:])
+				nameLen := int(binary.NativeEndian.Uint32(buf[offset + 12:]))
+
+				name := buf[offset + inotifyEventSize:offset + inotifyEventSize + nameLen]
+				name = bytes.TrimRight(name, "\x00")
+				offset += inotifyEventSize + nameLen
+
+				dir, ok := watches[wd]
+				if !ok || len(name) == 0 {
+					continue
+				}
+				path := filepath.Join(dir, string(name))
+
+				if mask & syscall.IN_ISDIR != 0 {
+					if mask & syscall.IN_CREATE != 0 || mask & syscall.IN_MOVED_TO != 0 {
+						addWatch(path)
+					}
+					continue
+				}
+
+				changes <- path
+			}
+		}
+	}()
+
+	return nil
+}
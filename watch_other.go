@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func watchNotify(dirs []string, changes chan<- string) error {
+	return errors.New("file notifications are only supported on linux")
+}
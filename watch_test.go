@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"time"
+	"slices"
+	"testing"
+	"path/filepath"
+)
+
+func TestIsInDir(t *testing.T) {
+	tests := []struct {
+		path string
+		dir string
+		want bool
+	}{
+		{"articles/post.md", "articles", true},
+		{"./articles/post.md", "articles/", true},
+		{"articles/sub/post.md", "articles", true},
+		{"articles", "articles", false},
+		{"articles-old/post.md", "articles", false},
+		{"templates/index.html", "articles", false},
+	}
+
+	for _, test := range tests {
+		if got := isInDir(test.path, test.dir); got != test.want {
+			t.Errorf("isInDir(%q, %q) = %v, want %v", test.path, test.dir, got, test.want)
+		}
+	}
+}
+
+func TestDebounceChanges(t *testing.T) {
+	changes := make(chan string)
+	batches := make(chan []string)
+	go debounceChanges(changes, batches)
+
+	for _, path := range []string{"a.md", "b.md", "a.md"} {
+		changes <- path
+	}
+	if batch := <-batches; !slices.Equal(batch, []string{"a.md", "b.md"}) {
+		t.Errorf("batch %q, want [a.md b.md]", batch)
+	}
+
+	changes <- "c.md"
+	if batch := <-batches; !slices.Equal(batch, []string{"c.md"}) {
+		t.Errorf("batch %q, want [c.md]", batch)
+	}
+	close(changes)
+}
+
+func TestWatchDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"sub/old.md": "old"})
+	batches := WatchDirectories([]string{dir}, 50 * time.Millisecond)
+
+	// Notifications and polling start before the first change
+	time.Sleep(200 * time.Millisecond)
+
+	steps := []struct {
+		name string
+		change func() error
+		path string
+	}{
+		{"create", func() error { return os.WriteFile(filepath.Join(dir, "new.md"), []byte("new"), 0o644) }, "new.md"},
+		{"write in subdirectory", func() error { return os.WriteFile(filepath.Join(dir, "sub", "old.md"), []byte("changed"), 0o644) }, "sub/old.md"},
+		{"remove", func() error { return os.Remove(filepath.Join(dir, "new.md")) }, "new.md"},
+	}
+
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := filepath.Join(dir, filepath.FromSlash(step.path))
+		select {
+		case batch := <-batches:
+			if !slices.Contains(batch, want) {
+				t.Errorf("%s: batch %q does not contain %s", step.name, batch, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no change reported", step.name)
+		}
+	}
+}